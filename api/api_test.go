@@ -0,0 +1,26 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// serveStatus runs the request through the handler and returns the
+// response status, or the status of the *echo.HTTPError it returned.
+func serveStatus(t *testing.T, handler echo.HandlerFunc, req *http.Request) int {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+
+	err := handler(echo.New().NewContext(req, rec))
+	if he, ok := err.(*echo.HTTPError); ok {
+		return he.Code
+	} else if err != nil {
+		t.Fatalf("%s %s: %v", req.Method, req.URL, err)
+	}
+
+	return rec.Code
+}
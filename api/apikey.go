@@ -0,0 +1,125 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/zjeremiah/stdlib/auth"
+	"github.com/zjeremiah/stdlib/stats"
+)
+
+// Reasons a request can be rejected with by APIKeyAuth.
+const (
+	ReasonInvalidAPIKey = "invalid_api_key"
+	ReasonMissingScope  = "missing_scope"
+)
+
+// DefaultAPIKeyHeader is the header APIKeyAuth reads the key from.
+const DefaultAPIKeyHeader = "X-API-Key"
+
+type (
+	// APIKeyAuthenticator resolves a plain text API key. auth.APIKeyStore
+	// implements it.
+	APIKeyAuthenticator interface {
+		Authenticate(key string) (*auth.APIKey, error)
+	}
+
+	// APIKeyConfig configures APIKeyAuth.
+	APIKeyConfig struct {
+		Skipper middleware.Skipper
+
+		Keys APIKeyAuthenticator
+
+		// Header is the header the key is read from. It defaults to
+		// DefaultAPIKeyHeader. Keys are also accepted as
+		// "Authorization: ApiKey <key>".
+		Header string
+
+		// RequiredScopes must all be carried by the key.
+		RequiredScopes []string
+
+		// Fallback handles requests that carry no API key, e.g. RMAuthJWT,
+		// so both schemes can protect the same routes. Without a Fallback
+		// such requests are rejected.
+		Fallback echo.MiddlewareFunc
+
+		// Stats counts rejected keys by reason. It may be nil.
+		Stats stats.Client
+	}
+)
+
+// APIKeyAuth returns a middleware that authenticates requests by API key.
+// An accepted key's principal is stored with SetPrincipal, so handlers see
+// the same "username", "roles" and "id" values as with RMAuthJWT.
+func APIKeyAuth(config APIKeyConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+
+	if config.Header == "" {
+		config.Header = DefaultAPIKeyHeader
+	}
+
+	if config.Stats == nil {
+		config.Stats = new(stats.NoOpClient)
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		var fallback echo.HandlerFunc
+		if config.Fallback != nil {
+			fallback = config.Fallback(next)
+		}
+
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			plain := apiKeyFromRequest(c.Request(), config.Header)
+			if plain == "" {
+				if fallback != nil {
+					return fallback(c)
+				}
+
+				return rejectAuth(config.Stats, http.StatusBadRequest, ReasonMissingToken, "missing api key", nil)
+			}
+
+			key, err := config.Keys.Authenticate(plain)
+			switch err {
+			case nil:
+			case auth.ErrAPIKeyExpired:
+				return rejectAuth(config.Stats, http.StatusUnauthorized, ReasonExpired, "api key is expired", err)
+			case auth.ErrInvalidAPIKey:
+				return rejectAuth(config.Stats, http.StatusUnauthorized, ReasonInvalidAPIKey, "invalid api key", err)
+			default:
+				return err
+			}
+
+			for _, scope := range config.RequiredScopes {
+				if !key.HasScope(scope) {
+					return rejectAuth(config.Stats, http.StatusForbidden, ReasonMissingScope, "missing scope: "+scope, nil)
+				}
+			}
+
+			SetPrincipal(c, key.Principal())
+
+			return next(c)
+		}
+	}
+}
+
+func apiKeyFromRequest(r *http.Request, header string) string {
+	if key := r.Header.Get(header); key != "" {
+		return key
+	}
+
+	const scheme = "ApiKey "
+
+	if authz := r.Header.Get(echo.HeaderAuthorization); len(authz) > len(scheme) && strings.EqualFold(authz[:len(scheme)], scheme) {
+		return strings.TrimSpace(authz[len(scheme):])
+	}
+
+	return ""
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/zjeremiah/stdlib/auth"
+)
+
+// staticAPIKeys authenticates the keys in the map. Unknown keys are invalid.
+type staticAPIKeys map[string]*auth.APIKey
+
+func (s staticAPIKeys) Authenticate(plain string) (*auth.APIKey, error) {
+	switch key, ok := s[plain]; {
+	case plain == "expired":
+		return nil, auth.ErrAPIKeyExpired
+	case !ok:
+		return nil, auth.ErrInvalidAPIKey
+	default:
+		return key, nil
+	}
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	keys := staticAPIKeys{
+		"reader": {ID: "1", UserID: "7", Username: "bob", Scopes: "read"},
+		"writer": {ID: "2", UserID: "7", Username: "bob", Scopes: "read,write"},
+	}
+
+	var p *auth.Principal
+
+	handler := APIKeyAuth(APIKeyConfig{
+		Keys:           keys,
+		RequiredScopes: []string{"write"},
+	})(func(c echo.Context) error {
+		p, _ = PrincipalFrom(c)
+		return c.NoContent(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		code   int
+	}{
+		{"key in header", DefaultAPIKeyHeader, "writer", http.StatusOK},
+		{"key in authorization header", echo.HeaderAuthorization, "apikey writer", http.StatusOK},
+		{"missing scope", DefaultAPIKeyHeader, "reader", http.StatusForbidden},
+		{"invalid key", DefaultAPIKeyHeader, "unknown", http.StatusUnauthorized},
+		{"expired key", DefaultAPIKeyHeader, "expired", http.StatusUnauthorized},
+		{"bearer token", echo.HeaderAuthorization, "Bearer writer", http.StatusBadRequest},
+		{"missing key", "", "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		p = nil
+
+		req := bearerRequest(http.MethodGet, "")
+		if tt.header != "" {
+			req.Header.Set(tt.header, tt.value)
+		}
+
+		if code := serveStatus(t, handler, req); code != tt.code {
+			t.Errorf("%s: got status %d, want %d", tt.name, code, tt.code)
+		}
+
+		if tt.code == http.StatusOK && (p == nil || p.ID != "7") {
+			t.Errorf("%s: got principal %+v", tt.name, p)
+		}
+	}
+}
+
+func TestAPIKeyAuthFallback(t *testing.T) {
+	handler := APIKeyAuth(APIKeyConfig{
+		Keys:     staticAPIKeys{},
+		Fallback: RMAuthJWT(testJWTConfig()),
+	})(okHandler)
+
+	if code := serveStatus(t, handler, bearerRequest(http.MethodGet, testToken(t, nil))); code != http.StatusOK {
+		t.Errorf("token: got status %d, want %d", code, http.StatusOK)
+	}
+
+	if code := serveStatus(t, handler, bearerRequest(http.MethodGet, signedWith(t, []byte("other key")))); code != http.StatusUnauthorized {
+		t.Errorf("invalid token: got status %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	req := bearerRequest(http.MethodGet, testToken(t, nil))
+	req.Header.Set(DefaultAPIKeyHeader, "unknown")
+
+	if code := serveStatus(t, handler, req); code != http.StatusUnauthorized {
+		t.Errorf("invalid key with a token: got status %d, want %d", code, http.StatusUnauthorized)
+	}
+}
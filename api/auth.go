@@ -1,13 +1,14 @@
 package api
 
 import (
-	"encoding/base64"
-	"net/http"
+	"context"
+	"time"
 
-	jwt "github.com/dgrijalva/jwt-go"
+	jwt "github.com/golang-jwt/jwt"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/zjeremiah/stdlib/auth"
+	"github.com/zjeremiah/stdlib/stats"
 	"github.com/zjeremiah/stdlib/xhttp"
 )
 
@@ -18,18 +19,127 @@ type (
 		AppToken         string
 		Devmode          bool
 		AdditionalFields []string
+
+		// JWKSURL, when set, makes SetupAuth verify tokens against
+		// the keys published at this JWKS url instead of requesting
+		// signing keys from the AuthServer.
+		JWKSURL string
+
+		// RefreshInterval, when set, makes SetupAuth request the
+		// signing keys again on this interval and swap the key used
+		// to verify tokens. The refresher runs until Context is done.
+		RefreshInterval time.Duration
+
+		// Context stops the key refresher when it is done. If it is nil,
+		// the refresher runs for the life of the process.
+		Context context.Context
+
+		// Stats receives the key refresh metrics. It may be nil.
+		Stats stats.Client
+
+		// VerifyOnly makes SetupAuth verify tokens with the PublicKey
+		// handed out by the auth server. The private key is never parsed.
+		VerifyOnly bool
+
+		// RejectPrivateKey implies VerifyOnly and makes SetupAuth fail
+		// if the auth server hands out a private key at all.
+		RejectPrivateKey bool
+
+		// Algorithms is the allowlist of token algorithms, e.g. "RS256",
+		// "ES256" or "EdDSA". Tokens must also use an algorithm that
+		// belongs to the verification key's type. If empty, only the
+		// key's auth.DefaultAlgorithm is accepted.
+		Algorithms []string
+
+		// RequiredClaims, Issuer, Audience and Leeway are passed on to
+		// RMAuthJWTConfig.
+		RequiredClaims []string
+		Issuer         string
+		Audience       string
+		Leeway         time.Duration
+
+		// Revocations is passed on to RMAuthJWTConfig.
+		Revocations auth.RevocationStore
+
+		// Audit records rejected tokens and key refreshes. It may be nil.
+		Audit *auth.Auditor
+
+		// CookieName is passed on to RMAuthJWTConfig.
+		CookieName string
+
+		// Optional is passed on to RMAuthJWTConfig.
+		Optional func(c echo.Context) bool
+
+		// Provider replaces the RM Auth provider for AuthServer. If it is
+		// an auth.KeyfuncProvider, such as auth.OIDCProvider, tokens are
+		// verified with its Keyfunc instead of requested signing keys.
+		// For an auth.OIDCProvider, Issuer, Audience and RequiredClaims
+		// default to its issuer, its client ID and OIDCRequiredClaims.
+		Provider auth.Provider
+
+		// KeyFetchAttempts is how often SetupAuth requests the signing keys
+		// before giving up, backing off between attempts. It defaults to
+		// DefaultKeyFetchAttempts.
+		KeyFetchAttempts int
+
+		// KeyCacheFile, when set, is where the last obtained signing keys
+		// are kept, encrypted with the AppToken. SetupAuth falls back to
+		// them when the auth server can't be reached.
+		KeyCacheFile string
 	}
 
 	RMAuthJWTConfig struct {
 		middleware.JWTConfig
 
 		AdditionalFields []string
+
+		// RequiredClaims must be present in every token. If nil,
+		// DefaultRequiredClaims are required.
+		RequiredClaims []string
+
+		// Issuer, if set, must equal the "iss" claim.
+		Issuer string
+
+		// Audience, if set, must be in the "aud" claim.
+		Audience string
+
+		// Leeway is the clock skew allowed when checking the
+		// "exp", "nbf" and "iat" claims.
+		Leeway time.Duration
+
+		// Stats receives the auth_token_rejected counter. It may be nil.
+		Stats stats.Client
+
+		// Revocations, if set, is consulted for every token whose
+		// signature and claims are valid. Its "jti", "id" and "iat"
+		// claims are checked against revoked tokens and users.
+		Revocations auth.RevocationStore
+
+		// Audit records a token_rejected event for every rejected token.
+		// It may be nil.
+		Audit *auth.Auditor
+
+		// CookieName, if set, is a cookie the token is read from when the
+		// request has no Authorization header, e.g. the one set by
+		// LoginHandler. Protect such routes with CSRF.
+		CookieName string
+
+		// Optional, if set, reports whether authentication is optional
+		// for a request, e.g. for public pages personalized for users
+		// who are logged in. Such requests without a token continue
+		// without a principal; a token that is sent must still be valid.
+		Optional func(c echo.Context) bool
 	}
 )
 
-// DevSigningKey is a hardcoded key that's used to sign
-// JWT keys in development mode.
-var DevSigningKey = []byte("signingkey")
+// OIDCRequiredClaims are the claims required of tokens verified with an
+// auth.OIDCProvider when AuthOptions.RequiredClaims is nil.
+var OIDCRequiredClaims = []string{"sub"}
+
+// DevSigningKey is the key that's used to sign JWT keys in development
+// mode. It is generated randomly for every process, so tokens signed
+// with it can't be forged elsewhere. Use DevTokenHandler to get some.
+var DevSigningKey = newDevSigningKey()
 
 var DefaultRMAuthJWTConfig = RMAuthJWTConfig{
 	JWTConfig: middleware.DefaultJWTConfig,
@@ -39,8 +149,30 @@ var DefaultRMAuthJWTConfig = RMAuthJWTConfig{
 func SetupAuth(opts *AuthOptions, client xhttp.Client, skipper middleware.Skipper) (*auth.SigningKeys, echo.MiddlewareFunc, error) {
 	var signingKeys *auth.SigningKeys
 
+	if opts.Devmode && IsProduction() {
+		return nil, nil, ErrDevmodeInProduction
+	}
+
+	if !opts.Devmode && opts.JWKSURL != "" {
+		mw, err := setupJWKSAuth(opts, client, skipper)
+		return nil, mw, err
+	}
+
+	provider := opts.Provider
+	if provider == nil {
+		provider = auth.NewProviderWithClient(opts.AuthServer, client)
+	}
+
+	if kp, ok := provider.(auth.KeyfuncProvider); ok && !opts.Devmode {
+		if oidc, ok := kp.(*auth.OIDCProvider); ok {
+			return nil, opts.oidcDefaults(oidc).keyfuncAuth(kp.Keyfunc, skipper), nil
+		}
+
+		return nil, opts.keyfuncAuth(kp.Keyfunc, skipper), nil
+	}
+
 	if !opts.Devmode {
-		sk, err := auth.NewProviderWithClient(opts.AuthServer, client).RequestSigningKeys(opts.AppName, opts.AppToken)
+		sk, err := opts.fetchSigningKeys(provider)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -48,26 +180,35 @@ func SetupAuth(opts *AuthOptions, client xhttp.Client, skipper middleware.Skippe
 		signingKeys = sk
 	}
 
-	jwtConf := RMAuthJWTConfig{
-		AdditionalFields: opts.AdditionalFields,
-		JWTConfig:        middleware.DefaultJWTConfig,
-	}
-
-	jwtConf.JWTConfig.Skipper = skipper
+	jwtConf := opts.jwtConfig(skipper)
 
 	if signingKeys != nil {
-		b, err := base64.StdEncoding.DecodeString(signingKeys.PrivateKey)
+		key, err := opts.verificationKey(signingKeys)
 		if err != nil {
 			return nil, nil, err
 		}
 
-		privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(b)
-		if err != nil {
+		if _, err := auth.DefaultAlgorithm(key); err != nil {
 			return nil, nil, err
 		}
 
-		jwtConf.JWTConfig.SigningMethod = "RS256"
-		jwtConf.JWTConfig.SigningKey = &privateKey.PublicKey
+		jwtConf.JWTConfig.KeyFunc = auth.AllowedKeyfunc(func() interface{} { return key }, opts.Algorithms)
+
+		if opts.RefreshInterval > 0 {
+			refresher := NewKeyRefresher(provider, opts.AppName, opts.AppToken, key, opts.RefreshInterval, opts.Stats)
+			refresher.ParseKey = opts.verificationKey
+			refresher.Algorithms = opts.Algorithms
+			refresher.OnRefresh = opts.cacheSigningKeys
+			refresher.Audit = opts.Audit
+
+			if opts.Context != nil {
+				refresher.StartContext(opts.Context)
+			} else {
+				refresher.Start()
+			}
+
+			jwtConf.JWTConfig.KeyFunc = refresher.Keyfunc
+		}
 	} else {
 		jwtConf.JWTConfig.SigningMethod = "HS256"
 		jwtConf.JWTConfig.SigningKey = DevSigningKey
@@ -76,35 +217,152 @@ func SetupAuth(opts *AuthOptions, client xhttp.Client, skipper middleware.Skippe
 	return signingKeys, RMAuthJWT(jwtConf), nil
 }
 
+// jwtConfig returns the RMAuthJWTConfig described by the options, without a key.
+func (o *AuthOptions) jwtConfig(skipper middleware.Skipper) RMAuthJWTConfig {
+	jwtConf := RMAuthJWTConfig{
+		AdditionalFields: o.AdditionalFields,
+		JWTConfig:        middleware.DefaultJWTConfig,
+		RequiredClaims:   o.RequiredClaims,
+		Issuer:           o.Issuer,
+		Audience:         o.Audience,
+		Leeway:           o.Leeway,
+		Stats:            o.Stats,
+		Revocations:      o.Revocations,
+		Audit:            o.Audit,
+		CookieName:       o.CookieName,
+		Optional:         o.Optional,
+	}
+
+	jwtConf.JWTConfig.Skipper = skipper
+
+	return jwtConf
+}
+
+// verificationKey returns the key used to verify tokens signed with the given keys,
+// honoring VerifyOnly and RejectPrivateKey.
+func (o *AuthOptions) verificationKey(keys *auth.SigningKeys) (interface{}, error) {
+	if o.RejectPrivateKey && keys.PrivateKey != "" {
+		return nil, auth.ErrPrivateKeyExposed
+	}
+
+	if o.VerifyOnly || o.RejectPrivateKey {
+		return keys.VerificationKey()
+	}
+
+	return verificationKey(keys)
+}
+
+// verificationKey returns the public half of the private key in the given keys.
+func verificationKey(keys *auth.SigningKeys) (interface{}, error) {
+	privateKey, err := auth.ParsePrivateKey(keys.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return privateKey.Public(), nil
+}
+
+// setupJWKSAuth fetches the JWKS at opts.JWKSURL and returns a middleware
+// that verifies tokens against the key named by their "kid" header.
+func setupJWKSAuth(opts *AuthOptions, client xhttp.Client, skipper middleware.Skipper) (echo.MiddlewareFunc, error) {
+	provider := auth.NewJWKSProviderWithClient(opts.JWKSURL, client)
+
+	if err := provider.Refresh(); err != nil {
+		return nil, err
+	}
+
+	provider.Algorithms = opts.Algorithms
+
+	return opts.keyfuncAuth(provider.Keyfunc, skipper), nil
+}
+
+// oidcDefaults returns a copy of the options with Issuer, Audience and
+// RequiredClaims defaulting to what tokens of the OIDC provider carry,
+// so tokens minted by the issuer for other clients are rejected.
+func (o *AuthOptions) oidcDefaults(provider *auth.OIDCProvider) *AuthOptions {
+	opts := *o
+
+	if opts.Issuer == "" {
+		opts.Issuer = provider.Discovery().Issuer
+	}
+
+	if opts.Audience == "" {
+		opts.Audience = provider.ClientID()
+	}
+
+	if opts.RequiredClaims == nil {
+		opts.RequiredClaims = OIDCRequiredClaims
+	}
+
+	return &opts
+}
+
+// keyfuncAuth returns a middleware that verifies tokens with keyfunc,
+// additionally enforcing opts.Algorithms if set.
+func (o *AuthOptions) keyfuncAuth(keyfunc jwt.Keyfunc, skipper middleware.Skipper) echo.MiddlewareFunc {
+	jwtConf := o.jwtConfig(skipper)
+	jwtConf.JWTConfig.KeyFunc = keyfunc
+
+	if len(o.Algorithms) > 0 {
+		jwtConf.JWTConfig.KeyFunc = func(t *jwt.Token) (interface{}, error) {
+			key, err := keyfunc(t)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := auth.CheckAlgorithm(key, t.Method.Alg(), o.Algorithms); err != nil {
+				return nil, err
+			}
+
+			return key, nil
+		}
+	}
+
+	return RMAuthJWT(jwtConf)
+}
+
+// RMAuthJWT returns a middleware that validates a JWT, stores an
+// auth.Principal for it (see PrincipalFrom) and sets its "username",
+// "roles", "id" and AdditionalFields claims on the context.
+// Rejected tokens get an AuthError body explaining why. Requests without
+// a token are rejected too, unless authentication is Optional for them.
 func RMAuthJWT(config RMAuthJWTConfig) echo.MiddlewareFunc {
+	if config.ParseTokenFunc == nil {
+		config.ParseTokenFunc = config.parseToken
+	}
+
+	contextKey := config.ContextKey
+	if contextKey == "" {
+		contextKey = middleware.DefaultJWTConfig.ContextKey
+	}
+
+	if config.CookieName != "" {
+		if config.TokenLookup == "" {
+			config.TokenLookup = middleware.DefaultJWTConfig.TokenLookup
+		}
+
+		config.TokenLookup += ",cookie:" + config.CookieName
+	}
+
 	jwtMiddleware := middleware.JWTWithConfig(config.JWTConfig)
 
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			if err := jwtMiddleware(fakeHandler)(c); err != nil {
-				return err
+				if err == middleware.ErrJWTMissing && config.anonymous(c) {
+					return next(c)
+				}
+
+				return config.rejectToken(c, err)
 			}
 
-			if x := c.Get("user"); x != nil {
+			if x := c.Get(contextKey); x != nil {
 				if user, ok := x.(*jwt.Token); ok {
 					if claims, ok := user.Claims.(jwt.MapClaims); ok {
-						if username, ok := claims["username"]; ok {
-							c.Set("username", username)
-						} else {
-							return echo.NewHTTPError(http.StatusUnauthorized)
-						}
+						p := auth.NewPrincipal(claims)
+						p.Token = auth.Token(user.Raw)
 
-						if roles, ok := claims["roles"]; ok {
-							c.Set("roles", roles)
-						} else {
-							return echo.NewHTTPError(http.StatusUnauthorized)
-						}
-
-						if id, ok := claims["id"]; ok {
-							c.Set("id", id)
-						} else {
-							return echo.NewHTTPError(http.StatusUnauthorized)
-						}
+						SetPrincipal(c, p)
 
 						for _, field := range config.AdditionalFields {
 							if value, ok := claims[field]; ok {
@@ -120,6 +378,27 @@ func RMAuthJWT(config RMAuthJWTConfig) echo.MiddlewareFunc {
 	}
 }
 
+// anonymous reports whether the request may continue without a token:
+// authentication is Optional for it and it carries no Authorization
+// header or session cookie, not even a malformed one.
+func (config *RMAuthJWTConfig) anonymous(c echo.Context) bool {
+	if config.Optional == nil || !config.Optional(c) {
+		return false
+	}
+
+	if c.Request().Header.Get(echo.HeaderAuthorization) != "" {
+		return false
+	}
+
+	if config.CookieName != "" {
+		if _, err := c.Cookie(config.CookieName); err == nil {
+			return false
+		}
+	}
+
+	return true
+}
+
 func fakeHandler(c echo.Context) error {
 	return nil
 }
@@ -0,0 +1,292 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/zjeremiah/stdlib/auth"
+	"github.com/zjeremiah/stdlib/stats"
+)
+
+// Reasons a token can be rejected with. They are sent to clients in
+// AuthError.Reason and used as the "reason" label of auth_token_rejected.
+const (
+	ReasonMissingToken  = "missing_token"
+	ReasonInvalidToken  = "invalid_token"
+	ReasonExpired       = "expired"
+	ReasonNotYetValid   = "not_yet_valid"
+	ReasonWrongIssuer   = "wrong_issuer"
+	ReasonWrongAudience = "wrong_audience"
+	ReasonMissingClaim  = "missing_claim"
+	ReasonRevoked       = "revoked"
+
+	// ReasonRevocationUnavailable means the revocation store could not
+	// be consulted. Tokens are rejected rather than trusted in that case.
+	ReasonRevocationUnavailable = "revocation_unavailable"
+)
+
+// DefaultRequiredClaims are the claims RMAuthJWT requires when
+// RMAuthJWTConfig.RequiredClaims is nil.
+var DefaultRequiredClaims = []string{"username", "roles", "id"}
+
+// AuthError is the body of a response to a rejected token.
+type AuthError struct {
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+
+	err error
+}
+
+func (a *AuthError) Error() string {
+	if a.err != nil {
+		return fmt.Sprintf("%s: %s", a.Message, a.err)
+	}
+
+	return a.Message
+}
+
+// Unwrap returns the error that caused the rejection, if any.
+func (a *AuthError) Unwrap() error {
+	return a.err
+}
+
+func newAuthError(reason, message string, err error) *AuthError {
+	return &AuthError{Reason: reason, Message: message, err: err}
+}
+
+// rejectAuth counts a rejected credential in auth_token_rejected and
+// returns the response for it.
+func rejectAuth(statsClient stats.Client, code int, reason, message string, err error) error {
+	statsClient.Incr("auth_token_rejected", stats.Labels{"reason", reason}, 1)
+
+	return newAuthHTTPError(code, reason, message, err)
+}
+
+// newAuthHTTPError returns a response carrying an AuthError. The cause is
+// kept as the internal error only, so it is logged but not sent.
+func newAuthHTTPError(code int, reason, message string, err error) *echo.HTTPError {
+	return &echo.HTTPError{
+		Code:     code,
+		Message:  newAuthError(reason, message, nil),
+		Internal: err,
+	}
+}
+
+// parseToken parses and verifies a token, then validates its claims.
+// Standard claims are validated here instead of by the jwt library so
+// Leeway applies to them.
+func (config *RMAuthJWTConfig) parseToken(raw string, c echo.Context) (interface{}, error) {
+	parser := jwt.Parser{SkipClaimsValidation: true}
+
+	token, err := parser.Parse(raw, config.keyFunc)
+	if err != nil {
+		return nil, newAuthError(ReasonInvalidToken, "invalid jwt", err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, newAuthError(ReasonInvalidToken, "invalid jwt claims", nil)
+	}
+
+	if err := config.validateClaims(claims, time.Now()); err != nil {
+		return nil, err
+	}
+
+	if err := config.checkRevoked(claims); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (config *RMAuthJWTConfig) checkRevoked(claims jwt.MapClaims) error {
+	if config.Revocations == nil {
+		return nil
+	}
+
+	var issuedAt time.Time
+
+	if iat, ok, _ := numericClaim(claims, "iat"); ok {
+		issuedAt = time.Unix(iat, 0)
+	}
+
+	jti, _ := claims["jti"].(string)
+
+	revoked, err := config.Revocations.IsRevoked(jti, auth.NewPrincipal(claims).ID, issuedAt)
+	if err != nil {
+		return newAuthError(ReasonRevocationUnavailable, "could not check token revocation", err)
+	}
+
+	if revoked {
+		return newAuthError(ReasonRevoked, "token has been revoked", nil)
+	}
+
+	return nil
+}
+
+// keyFunc mirrors the echo JWT middleware's key lookup when no KeyFunc is configured.
+func (config *RMAuthJWTConfig) keyFunc(t *jwt.Token) (interface{}, error) {
+	if config.KeyFunc != nil {
+		return config.KeyFunc(t)
+	}
+
+	method := config.SigningMethod
+	if method == "" {
+		method = middleware.AlgorithmHS256
+	}
+
+	if t.Method.Alg() != method {
+		return nil, fmt.Errorf("unexpected jwt signing method=%v", t.Header["alg"])
+	}
+
+	if len(config.SigningKeys) > 0 {
+		if kid, ok := t.Header["kid"].(string); ok {
+			if key, ok := config.SigningKeys[kid]; ok {
+				return key, nil
+			}
+		}
+
+		return nil, fmt.Errorf("unexpected jwt key id=%v", t.Header["kid"])
+	}
+
+	return config.SigningKey, nil
+}
+
+func (config *RMAuthJWTConfig) validateClaims(claims jwt.MapClaims, now time.Time) error {
+	leeway := int64(config.Leeway / time.Second)
+	unix := now.Unix()
+
+	if exp, ok, err := numericClaim(claims, "exp"); err != nil {
+		return err
+	} else if ok && unix > exp+leeway {
+		return newAuthError(ReasonExpired, "token is expired", nil)
+	}
+
+	if nbf, ok, err := numericClaim(claims, "nbf"); err != nil {
+		return err
+	} else if ok && unix+leeway < nbf {
+		return newAuthError(ReasonNotYetValid, "token is not valid yet", nil)
+	}
+
+	if iat, ok, err := numericClaim(claims, "iat"); err != nil {
+		return err
+	} else if ok && unix+leeway < iat {
+		return newAuthError(ReasonNotYetValid, "token was issued in the future", nil)
+	}
+
+	if config.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != config.Issuer {
+			return newAuthError(ReasonWrongIssuer, "token has the wrong issuer", nil)
+		}
+	}
+
+	if config.Audience != "" && !hasAudience(claims["aud"], config.Audience) {
+		return newAuthError(ReasonWrongAudience, "token has the wrong audience", nil)
+	}
+
+	required := config.RequiredClaims
+	if required == nil {
+		required = DefaultRequiredClaims
+	}
+
+	for _, name := range required {
+		if _, ok := claims[name]; !ok {
+			return newAuthError(ReasonMissingClaim, "missing claim: "+name, nil)
+		}
+	}
+
+	return nil
+}
+
+// numericClaim returns a NumericDate claim as unix seconds.
+func numericClaim(claims jwt.MapClaims, name string) (int64, bool, error) {
+	switch v := claims[name].(type) {
+	case nil:
+		return 0, false, nil
+	case float64:
+		return int64(v), true, nil
+	case json.Number:
+		i, err := v.Int64()
+		if err != nil {
+			f, ferr := v.Float64()
+			if ferr != nil {
+				return 0, false, newAuthError(ReasonInvalidToken, "invalid claim: "+name, err)
+			}
+
+			i = int64(f)
+		}
+
+		return i, true, nil
+	default:
+		return 0, false, newAuthError(ReasonInvalidToken, "invalid claim: "+name, nil)
+	}
+}
+
+// hasAudience reports whether the "aud" claim, a string or a list of
+// strings, contains audience.
+func hasAudience(aud interface{}, audience string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == audience
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok && s == audience {
+				return true
+			}
+		}
+	case []string:
+		for _, s := range v {
+			if s == audience {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// rejectToken turns an error from the JWT middleware into a response
+// carrying an AuthError and records the rejection reason.
+func (config *RMAuthJWTConfig) rejectToken(c echo.Context, err error) error {
+	var authErr *AuthError
+
+	code := http.StatusUnauthorized
+
+	switch {
+	case errors.As(err, &authErr):
+	case err == middleware.ErrJWTMissing:
+		code = http.StatusBadRequest
+		authErr = newAuthError(ReasonMissingToken, "missing or malformed jwt", nil)
+	default:
+		return err
+	}
+
+	if config.Stats != nil {
+		config.Stats.Incr("auth_token_rejected", stats.Labels{"reason", authErr.Reason}, 1)
+	}
+
+	event := auth.AuditEvent{
+		Type:     auth.EventTokenRejected,
+		Reason:   authErr.Reason,
+		ClientIP: c.RealIP(),
+		Path:     c.Request().URL.Path,
+	}
+
+	if authErr.err != nil {
+		event.Error = authErr.err.Error()
+	}
+
+	config.Audit.Record(event)
+
+	return &echo.HTTPError{
+		Code:     code,
+		Message:  authErr,
+		Internal: authErr.err,
+	}
+}
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/zjeremiah/stdlib/auth"
+)
+
+var testSigningKey = []byte("test signing key")
+
+// testToken returns an HS256 token signed with testSigningKey carrying
+// the claims on top of valid "username", "roles", "id" and "exp" claims.
+// Claims set to nil are left out.
+func testToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+
+	all := jwt.MapClaims{
+		"username": "bob",
+		"roles":    []string{"admin"},
+		"id":       "1",
+		"exp":      time.Now().Add(time.Hour).Unix(),
+	}
+
+	for k, v := range claims {
+		if v == nil {
+			delete(all, k)
+		} else {
+			all[k] = v
+		}
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, all).SignedString(testSigningKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+// testJWTConfig returns an RMAuthJWTConfig verifying testToken's tokens.
+func testJWTConfig() RMAuthJWTConfig {
+	config := RMAuthJWTConfig{JWTConfig: middleware.DefaultJWTConfig}
+	config.SigningKey = testSigningKey
+
+	return config
+}
+
+func bearerRequest(method, token string) *http.Request {
+	req := httptest.NewRequest(method, "/", nil)
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+
+	return req
+}
+
+func okHandler(c echo.Context) error {
+	return c.NoContent(http.StatusOK)
+}
+
+func TestRMAuthJWTValidatesClaims(t *testing.T) {
+	config := testJWTConfig()
+	config.Issuer = "https://auth.example.com"
+	config.Audience = "app"
+	config.Leeway = time.Minute
+
+	handler := RMAuthJWT(config)(okHandler)
+
+	now := time.Now()
+	valid := jwt.MapClaims{"iss": "https://auth.example.com", "aud": []string{"other", "app"}}
+
+	with := func(claims jwt.MapClaims) jwt.MapClaims {
+		merged := jwt.MapClaims{}
+		for k, v := range valid {
+			merged[k] = v
+		}
+
+		for k, v := range claims {
+			merged[k] = v
+		}
+
+		return merged
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		code  int
+	}{
+		{"valid", testToken(t, valid), http.StatusOK},
+		{"expired within leeway", testToken(t, with(jwt.MapClaims{"exp": now.Add(-30 * time.Second).Unix()})), http.StatusOK},
+		{"expired", testToken(t, with(jwt.MapClaims{"exp": now.Add(-time.Hour).Unix()})), http.StatusUnauthorized},
+		{"not yet valid", testToken(t, with(jwt.MapClaims{"nbf": now.Add(time.Hour).Unix()})), http.StatusUnauthorized},
+		{"issued in the future", testToken(t, with(jwt.MapClaims{"iat": now.Add(time.Hour).Unix()})), http.StatusUnauthorized},
+		{"wrong issuer", testToken(t, with(jwt.MapClaims{"iss": "https://evil.example.com"})), http.StatusUnauthorized},
+		{"wrong audience", testToken(t, with(jwt.MapClaims{"aud": "other"})), http.StatusUnauthorized},
+		{"missing claim", testToken(t, with(jwt.MapClaims{"roles": nil})), http.StatusUnauthorized},
+		{"malformed exp", testToken(t, with(jwt.MapClaims{"exp": "tomorrow"})), http.StatusUnauthorized},
+		{"wrong key", signedWith(t, []byte("other key")), http.StatusUnauthorized},
+		{"missing", "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		if code := serveStatus(t, handler, bearerRequest(http.MethodGet, tt.token)); code != tt.code {
+			t.Errorf("%s: got status %d, want %d", tt.name, code, tt.code)
+		}
+	}
+}
+
+func TestRMAuthJWTRequiredClaims(t *testing.T) {
+	config := testJWTConfig()
+	config.RequiredClaims = []string{"tenant"}
+
+	handler := RMAuthJWT(config)(okHandler)
+
+	if code := serveStatus(t, handler, bearerRequest(http.MethodGet, testToken(t, nil))); code != http.StatusUnauthorized {
+		t.Errorf("token without tenant: got status %d, want 401", code)
+	}
+
+	token := testToken(t, jwt.MapClaims{"tenant": "acme", "username": nil, "roles": nil, "id": nil})
+	if code := serveStatus(t, handler, bearerRequest(http.MethodGet, token)); code != http.StatusOK {
+		t.Errorf("token with only the required claims: got status %d, want 200", code)
+	}
+}
+
+func signedWith(t *testing.T, key []byte) string {
+	t.Helper()
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"username": "bob",
+		"roles":    []string{},
+		"id":       "1",
+	}).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+// failingRevocations fails every lookup.
+type failingRevocations struct {
+	auth.RevocationStore
+}
+
+func (failingRevocations) IsRevoked(jti, userID string, issuedAt time.Time) (bool, error) {
+	return false, errors.New("store is down")
+}
+
+func TestRMAuthJWTRevocations(t *testing.T) {
+	revocations := auth.NewMemoryRevocationStore()
+	now := time.Now()
+
+	if err := revocations.RevokeToken("revoked", now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := revocations.RevokeUser("2", now.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	config := testJWTConfig()
+	config.Revocations = revocations
+
+	handler := RMAuthJWT(config)(okHandler)
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		reason string
+	}{
+		{"not revoked", jwt.MapClaims{"jti": "fresh"}, ""},
+		{"revoked token", jwt.MapClaims{"jti": "revoked"}, ReasonRevoked},
+		{"user revoked after issue", jwt.MapClaims{"id": "2", "iat": now.Add(-time.Hour).Unix()}, ReasonRevoked},
+		{"user revoked without iat", jwt.MapClaims{"id": "2"}, ReasonRevoked},
+		{"user revoked before issue", jwt.MapClaims{"id": "2", "iat": now.Unix()}, ""},
+	}
+
+	for _, tt := range tests {
+		if reason := rejectionReason(t, handler, testToken(t, tt.claims)); reason != tt.reason {
+			t.Errorf("%s: got reason %q, want %q", tt.name, reason, tt.reason)
+		}
+	}
+
+	config.Revocations = failingRevocations{}
+
+	handler = RMAuthJWT(config)(okHandler)
+
+	if reason := rejectionReason(t, handler, testToken(t, nil)); reason != ReasonRevocationUnavailable {
+		t.Errorf("failing store: got reason %q, want %q", reason, ReasonRevocationUnavailable)
+	}
+}
+
+// rejectionReason returns the reason a token was rejected with by a
+// handler, or "" if it was accepted. Rejections must be 401s.
+func rejectionReason(t *testing.T, handler echo.HandlerFunc, token string) string {
+	t.Helper()
+
+	req := bearerRequest(http.MethodGet, token)
+
+	err := handler(echo.New().NewContext(req, httptest.NewRecorder()))
+	if err == nil {
+		return ""
+	}
+
+	he, ok := err.(*echo.HTTPError)
+	if !ok || he.Code != http.StatusUnauthorized {
+		t.Fatalf("got error %v, want a 401", err)
+	}
+
+	authErr, ok := he.Message.(*AuthError)
+	if !ok {
+		t.Fatalf("got message %v, want an *AuthError", he.Message)
+	}
+
+	return authErr.Reason
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"errors"
+	"time"
+
+	"github.com/zjeremiah/stdlib/auth"
+	"github.com/zjeremiah/stdlib/stats"
+)
+
+// DefaultKeyFetchAttempts is how often SetupAuth requests the signing keys
+// before giving up or falling back to the KeyCacheFile.
+const DefaultKeyFetchAttempts = 5
+
+// fetchSigningKeys requests the signing keys, retrying with backoff. Keys
+// that are obtained are written to the KeyCacheFile. If the auth server
+// can't be reached, rather than refusing the service, the cached keys are
+// returned instead.
+func (o *AuthOptions) fetchSigningKeys(provider auth.Provider) (*auth.SigningKeys, error) {
+	attempts := o.KeyFetchAttempts
+	if attempts <= 0 {
+		attempts = DefaultKeyFetchAttempts
+	}
+
+	var err error
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+		var keys *auth.SigningKeys
+
+		keys, err = provider.RequestSigningKeys(o.AppName, o.AppToken)
+		if err == nil {
+			o.cacheSigningKeys(keys)
+			return keys, nil
+		}
+
+		if errors.Is(err, auth.ErrNoJWTKeys) {
+			return nil, err
+		}
+
+		if attempt < attempts {
+			time.Sleep(backoff(attempt, DefaultRefreshRetryBase, DefaultRefreshMaxBackoff))
+		}
+	}
+
+	if o.KeyCacheFile == "" {
+		return nil, err
+	}
+
+	keys, cacheErr := auth.LoadSigningKeys(o.KeyCacheFile, o.AppToken)
+	if cacheErr != nil {
+		o.statsClient().Incr("auth_key_cache_errors", stats.EmptyLabels(), 1)
+		return nil, err
+	}
+
+	o.statsClient().Incr("auth_key_cache_fallbacks", stats.EmptyLabels(), 1)
+	o.statsClient().Gauge("auth_key_cache_in_use", stats.EmptyLabels(), 1)
+
+	return keys, nil
+}
+
+// cacheSigningKeys writes the keys to the KeyCacheFile, if there is one.
+// Only the public key is kept when the private key is never used.
+func (o *AuthOptions) cacheSigningKeys(keys *auth.SigningKeys) {
+	o.statsClient().Gauge("auth_key_cache_in_use", stats.EmptyLabels(), 0)
+
+	if o.KeyCacheFile == "" {
+		return
+	}
+
+	if o.VerifyOnly || o.RejectPrivateKey {
+		keys = &auth.SigningKeys{PublicKey: keys.PublicKey}
+	}
+
+	if err := auth.SaveSigningKeys(o.KeyCacheFile, keys, o.AppToken); err != nil {
+		o.statsClient().Incr("auth_key_cache_errors", stats.EmptyLabels(), 1)
+	}
+}
+
+func (o *AuthOptions) statsClient() stats.Client {
+	if o.Stats == nil {
+		return new(stats.NoOpClient)
+	}
+
+	return o.Stats
+}
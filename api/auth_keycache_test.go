@@ -0,0 +1,105 @@
+package api
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/zjeremiah/stdlib/auth"
+)
+
+// flakyKeysProvider fails with the errors in turn, then hands out keys.
+type flakyKeysProvider struct {
+	errs  []error
+	keys  *auth.SigningKeys
+	calls int
+}
+
+func (p *flakyKeysProvider) Login(username, password string) (auth.Token, error) {
+	return nil, auth.ErrInvalidLogin
+}
+
+func (p *flakyKeysProvider) RequestSigningKeys(name, token string) (*auth.SigningKeys, error) {
+	p.calls++
+
+	if len(p.errs) > 0 {
+		err := p.errs[0]
+		p.errs = p.errs[1:]
+
+		return nil, err
+	}
+
+	return p.keys, nil
+}
+
+var (
+	testKeys       = &auth.SigningKeys{PublicKey: "public", PrivateKey: "private"}
+	errUnavailable = fmt.Errorf("%w: 503 Service Unavailable", auth.ErrAuthUnavailable)
+)
+
+func TestFetchSigningKeysRetries(t *testing.T) {
+	provider := &flakyKeysProvider{errs: []error{errUnavailable}, keys: testKeys}
+	opts := &AuthOptions{KeyFetchAttempts: 2}
+
+	got, err := opts.fetchSigningKeys(provider)
+	if err != nil || got != testKeys || provider.calls != 2 {
+		t.Errorf("got %v, %v after %d calls, want the keys after 2", got, err, provider.calls)
+	}
+}
+
+func TestFetchSigningKeysDoesNotRetryRefusals(t *testing.T) {
+	provider := &flakyKeysProvider{errs: []error{auth.ErrNoJWTKeys}, keys: testKeys}
+	opts := &AuthOptions{KeyFetchAttempts: 2}
+
+	if _, err := opts.fetchSigningKeys(provider); err != auth.ErrNoJWTKeys || provider.calls != 1 {
+		t.Errorf("got %v after %d calls, want %v after 1", err, provider.calls, auth.ErrNoJWTKeys)
+	}
+}
+
+func TestFetchSigningKeysFallsBackToCache(t *testing.T) {
+	opts := &AuthOptions{
+		AppToken:         "app-token",
+		KeyFetchAttempts: 1,
+		KeyCacheFile:     filepath.Join(t.TempDir(), "keys.cache"),
+	}
+
+	if _, err := opts.fetchSigningKeys(&flakyKeysProvider{errs: []error{errUnavailable}}); err != errUnavailable {
+		t.Errorf("without a cache: got %v, want %v", err, errUnavailable)
+	}
+
+	if _, err := opts.fetchSigningKeys(&flakyKeysProvider{keys: testKeys}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := opts.fetchSigningKeys(&flakyKeysProvider{errs: []error{errUnavailable}})
+	if err != nil || *got != *testKeys {
+		t.Errorf("got %v, %v, want the cached keys", got, err)
+	}
+
+	if _, err := opts.fetchSigningKeys(&flakyKeysProvider{errs: []error{auth.ErrNoJWTKeys}}); err != auth.ErrNoJWTKeys {
+		t.Errorf("refused: got %v, want %v", err, auth.ErrNoJWTKeys)
+	}
+
+	opts.AppToken = "other-token"
+
+	if _, err := opts.fetchSigningKeys(&flakyKeysProvider{errs: []error{errUnavailable}}); err != errUnavailable {
+		t.Errorf("cache of another token: got %v, want %v", err, errUnavailable)
+	}
+}
+
+func TestFetchSigningKeysCachesPublicKeyWhenVerifyingOnly(t *testing.T) {
+	opts := &AuthOptions{
+		AppToken:     "app-token",
+		VerifyOnly:   true,
+		KeyCacheFile: filepath.Join(t.TempDir(), "keys.cache"),
+	}
+
+	if _, err := opts.fetchSigningKeys(&flakyKeysProvider{keys: testKeys}); err != nil {
+		t.Fatal(err)
+	}
+
+	cached, err := auth.LoadSigningKeys(opts.KeyCacheFile, opts.AppToken)
+	if err != nil || cached.PrivateKey != "" || cached.PublicKey != "public" {
+		t.Errorf("got cached keys %+v, %v, want only the public key", cached, err)
+	}
+}
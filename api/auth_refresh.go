@@ -0,0 +1,224 @@
+package api
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/zjeremiah/stdlib/auth"
+	"github.com/zjeremiah/stdlib/stats"
+)
+
+const (
+	// DefaultRefreshRetryBase is the first delay before retrying a failed key refresh.
+	DefaultRefreshRetryBase = time.Second
+
+	// DefaultRefreshMaxBackoff caps the delay between retries of a failed key refresh.
+	DefaultRefreshMaxBackoff = time.Minute * 5
+)
+
+// KeyRefresher re-requests the signing keys from an auth.Provider on an
+// interval and swaps the key used to verify tokens. Requests that are
+// already being verified keep the key they started with.
+type KeyRefresher struct {
+	provider auth.Provider
+	name     string
+	token    string
+	stats    stats.Client
+
+	// Interval is the time between two successful refreshes.
+	Interval time.Duration
+
+	// Jitter is the upper bound of a random delay added to Interval
+	// so replicas don't hit the auth server at the same time.
+	Jitter time.Duration
+
+	// RetryBase is the delay before the first retry after a failure.
+	// It doubles with each consecutive failure up to MaxBackoff.
+	RetryBase time.Duration
+
+	// MaxBackoff caps the delay between retries.
+	MaxBackoff time.Duration
+
+	// ParseKey turns the obtained signing keys into the verification key.
+	// It defaults to using the public half of the private key.
+	ParseKey func(*auth.SigningKeys) (interface{}, error)
+
+	// Algorithms is the allowlist of token algorithms. See AuthOptions.Algorithms.
+	Algorithms []string
+
+	// OnRefresh, if set, is called with the keys of every successful refresh.
+	OnRefresh func(*auth.SigningKeys)
+
+	// Audit records every refresh and failed refresh. It may be nil.
+	Audit *auth.Auditor
+
+	key         atomic.Value // refreshedKey
+	failures    int64
+	lastRefresh int64
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// refreshedKey wraps the verification key, as atomic.Value only stores
+// values of one concrete type and the key's type changes when the auth
+// server moves from RSA to ECDSA or Ed25519 keys.
+type refreshedKey struct {
+	key interface{}
+}
+
+// NewKeyRefresher returns a KeyRefresher that verifies tokens with initial
+// until the first refresh succeeds. Call Start to begin refreshing.
+func NewKeyRefresher(provider auth.Provider, name, token string, initial interface{}, interval time.Duration, statsClient stats.Client) *KeyRefresher {
+	if statsClient == nil {
+		statsClient = new(stats.NoOpClient)
+	}
+
+	k := &KeyRefresher{
+		provider:   provider,
+		name:       name,
+		token:      token,
+		stats:      statsClient,
+		Interval:   interval,
+		Jitter:     interval / 10,
+		RetryBase:  DefaultRefreshRetryBase,
+		MaxBackoff: DefaultRefreshMaxBackoff,
+		ParseKey:   verificationKey,
+		stop:       make(chan struct{}),
+	}
+
+	k.key.Store(refreshedKey{initial})
+	atomic.StoreInt64(&k.lastRefresh, time.Now().UnixNano())
+
+	return k
+}
+
+// Start begins refreshing the keys in the background.
+func (k *KeyRefresher) Start() {
+	go k.run()
+}
+
+// StartContext is Start, but refreshing also stops once ctx is done.
+func (k *KeyRefresher) StartContext(ctx context.Context) {
+	go func() {
+		select {
+		case <-ctx.Done():
+			k.Stop()
+		case <-k.stop:
+		}
+	}()
+
+	k.Start()
+}
+
+// Stop stops refreshing the keys. The last obtained key stays in use.
+func (k *KeyRefresher) Stop() {
+	k.stopOnce.Do(func() {
+		close(k.stop)
+	})
+}
+
+// Key returns the current verification key.
+func (k *KeyRefresher) Key() interface{} {
+	return k.key.Load().(refreshedKey).key
+}
+
+// LastRefresh returns the time the keys were last obtained successfully.
+func (k *KeyRefresher) LastRefresh() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&k.lastRefresh))
+}
+
+// Failures returns the total number of failed refreshes.
+func (k *KeyRefresher) Failures() int64 {
+	return atomic.LoadInt64(&k.failures)
+}
+
+// Keyfunc is a jwt.Keyfunc that returns the current verification key.
+func (k *KeyRefresher) Keyfunc(t *jwt.Token) (interface{}, error) {
+	return auth.AllowedKeyfunc(k.Key, k.Algorithms)(t)
+}
+
+// Refresh requests the signing keys once and swaps the verification key
+// if they could be obtained.
+func (k *KeyRefresher) Refresh() error {
+	keys, err := k.provider.RequestSigningKeys(k.name, k.token)
+	if err == nil {
+		var key interface{}
+
+		key, err = k.ParseKey(keys)
+		if err == nil {
+			k.key.Store(refreshedKey{key})
+		}
+	}
+
+	if err != nil {
+		atomic.AddInt64(&k.failures, 1)
+		k.stats.Incr("auth_key_refresh_failures", stats.EmptyLabels(), 1)
+		k.Audit.Record(auth.AuditEvent{Type: auth.EventKeyRefreshFailure, Error: err.Error()})
+
+		return err
+	}
+
+	now := time.Now()
+	atomic.StoreInt64(&k.lastRefresh, now.UnixNano())
+	k.stats.Gauge("auth_key_refresh_last_success", stats.EmptyLabels(), float64(now.Unix()))
+	k.Audit.Record(auth.AuditEvent{Type: auth.EventKeyRefresh})
+
+	if k.OnRefresh != nil {
+		k.OnRefresh(keys)
+	}
+
+	return nil
+}
+
+func (k *KeyRefresher) run() {
+	consecutive := 0
+
+	for {
+		var wait time.Duration
+
+		if consecutive == 0 {
+			wait = k.Interval
+			if k.Jitter > 0 {
+				wait += time.Duration(rand.Int63n(int64(k.Jitter)))
+			}
+		} else {
+			wait = backoff(consecutive, k.RetryBase, k.MaxBackoff)
+		}
+
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-k.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if err := k.Refresh(); err != nil {
+			consecutive++
+		} else {
+			consecutive = 0
+		}
+	}
+}
+
+// backoff returns the delay before the given attempt, doubling base with
+// each attempt and never exceeding max.
+func backoff(attempt int, base, max time.Duration) time.Duration {
+	d := base
+
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+
+	if d > max {
+		d = max
+	}
+
+	return d
+}
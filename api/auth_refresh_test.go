@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/zjeremiah/stdlib/auth"
+)
+
+type rotatingProvider struct {
+	keys []crypto.Signer
+}
+
+func (p *rotatingProvider) Login(username, password string) (auth.Token, error) {
+	return nil, auth.ErrInvalidLogin
+}
+
+func (p *rotatingProvider) RequestSigningKeys(name, token string) (*auth.SigningKeys, error) {
+	key := p.keys[0]
+	p.keys = p.keys[1:]
+
+	return testSigningKeys(key)
+}
+
+// testSigningKeys returns signing keys holding the PEM encoded key.
+func testSigningKeys(key crypto.Signer) (*auth.SigningKeys, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &auth.SigningKeys{
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+	}, nil
+}
+
+func TestKeyRefresherRotatesKeyTypes(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := &rotatingProvider{keys: []crypto.Signer{ecKey, edKey, rsaKey}}
+
+	refresher := NewKeyRefresher(provider, "app", "token", rsaKey.Public(), time.Hour, nil)
+	refresher.Algorithms = []string{"RS256", "ES256", "EdDSA"}
+
+	steps := []struct {
+		key    crypto.Signer
+		method jwt.SigningMethod
+	}{
+		{ecKey, jwt.SigningMethodES256},
+		{edKey, jwt.SigningMethodEdDSA},
+		{rsaKey, jwt.SigningMethodRS256},
+	}
+
+	for _, step := range steps {
+		if err := refresher.Refresh(); err != nil {
+			t.Fatalf("refresh to %s key: %v", step.method.Alg(), err)
+		}
+
+		signed, err := jwt.NewWithClaims(step.method, jwt.MapClaims{"username": "bob"}).SignedString(step.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := jwt.Parse(signed, refresher.Keyfunc); err != nil {
+			t.Errorf("%s token rejected after refresh: %v", step.method.Alg(), err)
+		}
+	}
+
+	if refresher.Failures() != 0 {
+		t.Errorf("got %d failed refreshes, want 0", refresher.Failures())
+	}
+}
+
+type countingKeyProvider struct {
+	rotatingProvider
+
+	key      crypto.Signer
+	requests int64
+}
+
+func (p *countingKeyProvider) RequestSigningKeys(name, token string) (*auth.SigningKeys, error) {
+	atomic.AddInt64(&p.requests, 1)
+
+	return testSigningKeys(p.key)
+}
+
+func TestSetupAuthStopsRefresherWithContext(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := &countingKeyProvider{key: key}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	_, _, err = SetupAuth(&AuthOptions{
+		Provider:        provider,
+		RefreshInterval: 5 * time.Millisecond,
+		Context:         ctx,
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for atomic.LoadInt64(&provider.requests) < 3 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+
+	stopped := atomic.LoadInt64(&provider.requests)
+	time.Sleep(50 * time.Millisecond)
+
+	if n := atomic.LoadInt64(&provider.requests); n != stopped {
+		t.Errorf("got %d key requests after the context was done, want none", n-stopped)
+	}
+}
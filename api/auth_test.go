@@ -0,0 +1,234 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"github.com/zjeremiah/stdlib/auth"
+	"github.com/zjeremiah/stdlib/xhttp"
+)
+
+func TestSetupAuthOIDCDefaults(t *testing.T) {
+	issuer, err := auth.NewFakeOIDCIssuer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer issuer.Close()
+
+	issuer.AddClient("app", "secret")
+	issuer.AddUser("bob", "password", nil)
+
+	provider, err := auth.NewOIDCProvider(issuer.Issuer(), "app", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, mw, err := SetupAuth(&AuthOptions{Provider: provider}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// OIDC tokens have no "username" or "id" claims; the context values
+	// come from "preferred_username" and "sub".
+	handler := mw(func(c echo.Context) error {
+		if c.Get("username") != "bob" || c.Get("id") != "bob" {
+			return c.NoContent(http.StatusInternalServerError)
+		}
+
+		return c.NoContent(http.StatusOK)
+	})
+
+	userToken, err := provider.Login("bob", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherToken, err := issuer.Mint("some-other-client", map[string]interface{}{"sub": "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token auth.Token
+		code  int
+	}{
+		{"own client", userToken, http.StatusOK},
+		{"other client", otherToken, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+tt.token.String())
+
+		if code := serveStatus(t, handler, req); code != tt.code {
+			t.Errorf("%s: got status %d, want %d", tt.name, code, tt.code)
+		}
+	}
+}
+
+type staticKeysProvider struct {
+	keys *auth.SigningKeys
+}
+
+func (p *staticKeysProvider) Login(username, password string) (auth.Token, error) {
+	return nil, auth.ErrInvalidLogin
+}
+
+func (p *staticKeysProvider) RequestSigningKeys(name, token string) (*auth.SigningKeys, error) {
+	return p.keys, nil
+}
+
+func TestSetupAuthVerifyOnly(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicOnly := &auth.SigningKeys{PublicKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))}
+
+	_, mw, err := SetupAuth(&AuthOptions{Provider: &staticKeysProvider{publicOnly}, VerifyOnly: true}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"username": "bob",
+		"roles":    []string{},
+		"id":       "1",
+	}).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code := serveStatus(t, mw(okHandler), bearerRequest(http.MethodGet, signed)); code != http.StatusOK {
+		t.Errorf("token verified with the public key: got status %d, want 200", code)
+	}
+
+	withPrivate, err := testSigningKeys(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withPrivate.PublicKey = publicOnly.PublicKey
+
+	if _, _, err := SetupAuth(&AuthOptions{Provider: &staticKeysProvider{withPrivate}, RejectPrivateKey: true}, nil, nil); err != auth.ErrPrivateKeyExposed {
+		t.Errorf("private key handed out: got %v, want %v", err, auth.ErrPrivateKeyExposed)
+	}
+}
+
+func TestSetupAuthWithFakeAuthServer(t *testing.T) {
+	server, err := auth.NewFakeAuthServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer server.Close()
+
+	server.AddUser("bob@example.com", "secret", map[string]interface{}{"roles": []string{"admin"}})
+	server.AddService("app", "app-token")
+
+	opts := &AuthOptions{AuthServer: server.URL, AppName: "app", AppToken: "app-token"}
+
+	_, mw, err := SetupAuth(opts, xhttp.NewDefaultClient(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := auth.NewProvider(server.URL).Login("bob@example.com", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var p *auth.Principal
+
+	handler := mw(func(c echo.Context) error {
+		p, _ = PrincipalFrom(c)
+		return c.NoContent(http.StatusOK)
+	})
+
+	if code := serveStatus(t, handler, bearerRequest(http.MethodGet, token.String())); code != http.StatusOK {
+		t.Fatalf("token from the auth server: got status %d, want 200", code)
+	}
+
+	if p == nil || p.Username != "bob@example.com" || !p.HasRole("admin") {
+		t.Errorf("got principal %+v", p)
+	}
+
+	opts.AppToken = "wrong"
+
+	if _, _, err := SetupAuth(opts, xhttp.NewDefaultClient(), nil); err != auth.ErrNoJWTKeys {
+		t.Errorf("wrong app token: got %v, want %v", err, auth.ErrNoJWTKeys)
+	}
+}
+
+func TestRMAuthJWTOptional(t *testing.T) {
+	config := testJWTConfig()
+	config.CookieName = DefaultSessionCookie
+	config.Optional = func(c echo.Context) bool {
+		return c.Request().URL.Path == "/public"
+	}
+
+	var p *auth.Principal
+
+	handler := RMAuthJWT(config)(func(c echo.Context) error {
+		p, _ = PrincipalFrom(c)
+		return c.NoContent(http.StatusOK)
+	})
+
+	request := func(path, authorization, cookie string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if authorization != "" {
+			req.Header.Set(echo.HeaderAuthorization, authorization)
+		}
+
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: DefaultSessionCookie, Value: cookie})
+		}
+
+		return req
+	}
+
+	token := testToken(t, nil)
+	invalid := signedWith(t, []byte("other key"))
+
+	tests := []struct {
+		name      string
+		req       *http.Request
+		code      int
+		principal bool
+	}{
+		{"anonymous", request("/public", "", ""), http.StatusOK, false},
+		{"valid token", request("/public", "Bearer "+token, ""), http.StatusOK, true},
+		{"valid cookie", request("/public", "", token), http.StatusOK, true},
+		{"invalid token", request("/public", "Bearer "+invalid, ""), http.StatusUnauthorized, false},
+		{"invalid cookie", request("/public", "", invalid), http.StatusUnauthorized, false},
+		{"malformed header", request("/public", "Basic Ym9iOnNlY3JldA==", ""), http.StatusBadRequest, false},
+		{"anonymous on a protected path", request("/private", "", ""), http.StatusBadRequest, false},
+	}
+
+	for _, tt := range tests {
+		p = nil
+
+		if code := serveStatus(t, handler, tt.req); code != tt.code {
+			t.Errorf("%s: got status %d, want %d", tt.name, code, tt.code)
+		}
+
+		if (p != nil) != tt.principal {
+			t.Errorf("%s: got principal %+v, want one: %v", tt.name, p, tt.principal)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/zjeremiah/stdlib/auth"
+	"github.com/zjeremiah/stdlib/stats"
+)
+
+// Reasons a request can be denied with by an Authorizer.
+const (
+	ReasonUnauthenticated   = "unauthenticated"
+	ReasonMissingRole       = "missing_role"
+	ReasonMissingPermission = "missing_permission"
+)
+
+// PermissionWildcard grants every permission when listed for a role.
+const PermissionWildcard = "*"
+
+type (
+	// Policy maps roles to the permissions they grant. It is usually
+	// loaded from a JSON file of the form:
+	//
+	//  {
+	//  	"roles": {
+	//  		"admin": ["*"],
+	//  		"editor": ["posts:read", "posts:write"]
+	//  	}
+	//  }
+	Policy struct {
+		Roles map[string][]string `json:"roles"`
+	}
+
+	// Authorizer builds middleware that checks the roles and permissions
+	// of the auth.Principal set by RMAuthJWT. It must run after it.
+	Authorizer struct {
+		policy *Policy
+		stats  stats.Client
+	}
+)
+
+// LoadPolicy reads a Policy from a JSON file.
+func LoadPolicy(path string) (*Policy, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := new(Policy)
+	if err := json.Unmarshal(b, policy); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// Allows reports whether any of the roles grants the permission.
+func (p *Policy) Allows(roles []string, permission string) bool {
+	for _, role := range roles {
+		for _, granted := range p.Roles[role] {
+			if granted == permission || granted == PermissionWildcard {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// NewAuthorizer returns an Authorizer that checks permissions against the
+// given policy and counts denials in auth_authorization_denied.
+// Both policy and statsClient may be nil.
+func NewAuthorizer(policy *Policy, statsClient stats.Client) *Authorizer {
+	if policy == nil {
+		policy = new(Policy)
+	}
+
+	if statsClient == nil {
+		statsClient = new(stats.NoOpClient)
+	}
+
+	return &Authorizer{
+		policy: policy,
+		stats:  statsClient,
+	}
+}
+
+// RequireRoles only lets requests through whose principal has all of the roles.
+func (a *Authorizer) RequireRoles(roles ...string) echo.MiddlewareFunc {
+	return a.require(ReasonMissingRole, "missing role: "+strings.Join(roles, ", "), func(p *auth.Principal) bool {
+		for _, role := range roles {
+			if !p.HasRole(role) {
+				return false
+			}
+		}
+
+		return true
+	})
+}
+
+// RequireAnyRole only lets requests through whose principal has at least one of the roles.
+func (a *Authorizer) RequireAnyRole(roles ...string) echo.MiddlewareFunc {
+	return a.require(ReasonMissingRole, "requires one of the roles: "+strings.Join(roles, ", "), func(p *auth.Principal) bool {
+		for _, role := range roles {
+			if p.HasRole(role) {
+				return true
+			}
+		}
+
+		return false
+	})
+}
+
+// RequirePermission only lets requests through whose principal's roles
+// grant all of the permissions under the Authorizer's policy.
+func (a *Authorizer) RequirePermission(permissions ...string) echo.MiddlewareFunc {
+	return a.require(ReasonMissingPermission, "missing permission: "+strings.Join(permissions, ", "), func(p *auth.Principal) bool {
+		for _, permission := range permissions {
+			if !a.policy.Allows(p.Roles, permission) {
+				return false
+			}
+		}
+
+		return true
+	})
+}
+
+func (a *Authorizer) require(reason, message string, allowed func(p *auth.Principal) bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			p, ok := PrincipalFrom(c)
+			if !ok {
+				return a.deny(c, http.StatusUnauthorized, ReasonUnauthenticated, "authentication required")
+			}
+
+			if !allowed(p) {
+				return a.deny(c, http.StatusForbidden, reason, message)
+			}
+
+			return next(c)
+		}
+	}
+}
+
+func (a *Authorizer) deny(c echo.Context, code int, reason, message string) error {
+	a.stats.Incr("auth_authorization_denied", stats.Labels{
+		"reason", reason,
+		"path", c.Path(),
+	}, 1)
+
+	return &echo.HTTPError{
+		Code:    code,
+		Message: newAuthError(reason, message, nil),
+	}
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/zjeremiah/stdlib/auth"
+)
+
+// withRoles wraps handler so it runs as a principal with the roles, or
+// unauthenticated if roles is nil.
+func withRoles(roles []string, handler echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if roles != nil {
+			SetPrincipal(c, &auth.Principal{ID: "1", Roles: roles})
+		}
+
+		return handler(c)
+	}
+}
+
+func TestAuthorizer(t *testing.T) {
+	authorizer := NewAuthorizer(&Policy{Roles: map[string][]string{
+		"admin":  {PermissionWildcard},
+		"editor": {"posts:read", "posts:write"},
+		"viewer": {"posts:read"},
+	}}, nil)
+
+	tests := []struct {
+		name       string
+		middleware echo.MiddlewareFunc
+		roles      []string
+		code       int
+	}{
+		{"all roles", authorizer.RequireRoles("editor", "viewer"), []string{"viewer", "editor"}, http.StatusOK},
+		{"one of all roles", authorizer.RequireRoles("editor", "viewer"), []string{"viewer"}, http.StatusForbidden},
+		{"any role", authorizer.RequireAnyRole("editor", "viewer"), []string{"viewer"}, http.StatusOK},
+		{"none of any role", authorizer.RequireAnyRole("editor", "viewer"), []string{"admin"}, http.StatusForbidden},
+		{"granted permission", authorizer.RequirePermission("posts:write"), []string{"editor"}, http.StatusOK},
+		{"missing permission", authorizer.RequirePermission("posts:write"), []string{"viewer"}, http.StatusForbidden},
+		{"one of the permissions", authorizer.RequirePermission("posts:read", "posts:write"), []string{"viewer"}, http.StatusForbidden},
+		{"wildcard", authorizer.RequirePermission("users:delete"), []string{"admin"}, http.StatusOK},
+		{"unknown role", authorizer.RequirePermission("posts:read"), []string{"guest"}, http.StatusForbidden},
+		{"no roles", authorizer.RequireAnyRole("viewer"), []string{}, http.StatusForbidden},
+		{"unauthenticated", authorizer.RequireAnyRole("viewer"), nil, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		handler := withRoles(tt.roles, tt.middleware(okHandler))
+
+		if code := serveStatus(t, handler, bearerRequest(http.MethodGet, "")); code != tt.code {
+			t.Errorf("%s: got status %d, want %d", tt.name, code, tt.code)
+		}
+	}
+}
+
+func TestAuthorizerNilPolicy(t *testing.T) {
+	handler := withRoles([]string{"admin"}, NewAuthorizer(nil, nil).RequirePermission("posts:read")(okHandler))
+
+	if code := serveStatus(t, handler, bearerRequest(http.MethodGet, "")); code != http.StatusForbidden {
+		t.Errorf("got status %d, want %d", code, http.StatusForbidden)
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+
+	err := ioutil.WriteFile(path, []byte(`{"roles": {"editor": ["posts:read", "posts:write"]}}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !policy.Allows([]string{"editor"}, "posts:write") || policy.Allows([]string{"editor"}, "posts:delete") {
+		t.Errorf("got policy %+v", policy)
+	}
+
+	if _, err := LoadPolicy(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("want an error for a missing file")
+	}
+}
@@ -1,10 +1,12 @@
 package api
 
 import (
+	"encoding"
 	"errors"
 	"net/http"
 	"reflect"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -25,6 +27,22 @@ var (
 
 	// ErrInvalidBooleanFormat is an error stating that the given item is not a valid boolean format.
 	ErrInvalidBooleanFormat = echo.NewHTTPError(http.StatusBadRequest, "invalid boolean format")
+
+	// ErrInvalidDurationFormat is an error stating that the given item is not a valid duration, like "1h30m".
+	ErrInvalidDurationFormat = echo.NewHTTPError(http.StatusBadRequest, "invalid duration format")
+
+	// ErrInvalidQueryValue is an error stating that the given item could not be parsed by its TextUnmarshaler.
+	// The errors returned for it carry the unmarshaler's error as their Internal error.
+	ErrInvalidQueryValue = echo.NewHTTPError(http.StatusBadRequest, "invalid query value")
+
+	// ErrMissingQueryParam is the Internal error of the HTTPError returned for a missing required param.
+	ErrMissingQueryParam = errors.New("missing required query param")
+)
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
 )
 
 // Bind combines the echo bind function along with a model validator.
@@ -60,6 +78,13 @@ func BindQuery(c echo.Context, item interface{}) error {
 type DefaultQueryBinder struct{}
 
 // BindQuery binds (populates a struct) based on values in a query string.
+// Fields are bound from the param named by their query tag, e.g.
+// `query:"ids,required"`, and may be strings, bools, numbers of any kind,
+// time.Time in RFC3339, time.Duration, TextUnmarshalers, pointers to any
+// of these, or slices of them. Slices are bound from repeated and comma
+// separated params. Absent params leave the field unchanged, unless the
+// field has a `default:"..."` tag or is required. Struct fields without a
+// query tag are bound field by field.
 func (s *DefaultQueryBinder) BindQuery(c echo.Context, item interface{}) error {
 	rv := reflect.ValueOf(item)
 
@@ -77,92 +102,198 @@ func (s *DefaultQueryBinder) BindQuery(c echo.Context, item interface{}) error {
 }
 
 func (s *DefaultQueryBinder) loadData(c echo.Context, r reflect.Value) error {
-	for i := 0; i < r.NumField(); i++ {
-		tag := r.Type().Field(i).Tag.Get("query")
+	params := c.QueryParams()
 
+	for i := 0; i < r.NumField(); i++ {
+		structField := r.Type().Field(i)
 		field := r.Field(i)
 
-		param := c.QueryParam(tag)
-		if field.IsValid() && field.CanSet() && param != "" {
-			if err := s.set(field, param); err != nil {
-				return err
+		// Embedded structs of unexported types can't be set, but their
+		// exported fields can.
+		if !field.IsValid() || !field.CanSet() && !structField.Anonymous {
+			continue
+		}
+
+		name, options := parseQueryTag(structField.Tag.Get("query"))
+		if name == "-" {
+			continue
+		}
+
+		if name == "" {
+			if field.Kind() == reflect.Struct && !isQueryValue(field) {
+				if err := s.loadData(c, field); err != nil {
+					return err
+				}
 			}
+
+			continue
+		}
+
+		if !field.CanSet() {
+			continue
+		}
+
+		values := nonEmpty(params[name])
+
+		if len(values) == 0 {
+			if value, ok := structField.Tag.Lookup("default"); ok {
+				values = []string{value}
+			} else if options["required"] {
+				return &echo.HTTPError{
+					Code:     http.StatusBadRequest,
+					Message:  "missing required query param: " + name,
+					Internal: ErrMissingQueryParam,
+				}
+			} else {
+				continue
+			}
+		}
+
+		if err := s.setValues(field, values); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
+// setValues sets the field to the values of a param. Slices get every
+// value, with comma separated values split up; other fields the first.
+func (s *DefaultQueryBinder) setValues(field reflect.Value, values []string) error {
+	if field.Kind() != reflect.Slice || isQueryValue(field) {
+		return s.set(field, values[0])
+	}
+
+	var items []string
+
+	for _, value := range values {
+		items = append(items, nonEmpty(strings.Split(value, ","))...)
+	}
+
+	slice := reflect.MakeSlice(field.Type(), len(items), len(items))
+
+	for i, item := range items {
+		if err := s.set(slice.Index(i), strings.TrimSpace(item)); err != nil {
+			return err
+		}
+	}
+
+	field.Set(slice)
+
+	return nil
+}
+
 func (s *DefaultQueryBinder) set(field reflect.Value, value string) error {
-	switch field.Kind() {
-	case reflect.Int:
-		i, err := strconv.Atoi(value)
+	switch field.Type() {
+	case timeType:
+		t, err := time.Parse(time.RFC3339, value)
 		if err != nil {
-			return ErrInvalidNumberFormat
+			return ErrInvalidTimeFormat
 		}
 
-		s.setValue(field, i)
-	case reflect.Int16:
-		i, err := strconv.ParseInt(value, 10, 16)
+		field.Set(reflect.ValueOf(t))
+
+		return nil
+	case durationType:
+		d, err := time.ParseDuration(value)
 		if err != nil {
-			return ErrInvalidNumberFormat
+			return ErrInvalidDurationFormat
 		}
 
-		s.setValue(field, int16(i))
-	case reflect.Int32:
-		i, err := strconv.ParseInt(value, 10, 32)
-		if err != nil {
-			return ErrInvalidNumberFormat
+		field.SetInt(int64(d))
+
+		return nil
+	}
+
+	if field.Kind() != reflect.Ptr && field.CanAddr() {
+		if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			if err := u.UnmarshalText([]byte(value)); err != nil {
+				return &echo.HTTPError{
+					Code:     http.StatusBadRequest,
+					Message:  ErrInvalidQueryValue.Message,
+					Internal: err,
+				}
+			}
+
+			return nil
 		}
+	}
 
-		s.setValue(field, int32(i))
-	case reflect.Int64:
-		i, err := strconv.ParseInt(value, 10, 64)
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, field.Type().Bits())
 		if err != nil {
 			return ErrInvalidNumberFormat
 		}
 
-		s.setValue(field, int64(i))
-	case reflect.String:
-		s.setValue(field, value)
-	case reflect.Float32:
-		f, err := strconv.ParseFloat(value, 32)
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, field.Type().Bits())
 		if err != nil {
 			return ErrInvalidNumberFormat
 		}
 
-		s.setValue(field, float32(f))
-	case reflect.Float64:
-		f, err := strconv.ParseFloat(value, 64)
+		field.SetUint(u)
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
 		if err != nil {
 			return ErrInvalidNumberFormat
 		}
 
-		s.setValue(field, f)
+		field.SetFloat(f)
 	case reflect.Bool:
 		b, err := strconv.ParseBool(value)
 		if err != nil {
 			return ErrInvalidBoolFormat
 		}
 
-		s.setValue(field, b)
+		field.SetBool(b)
 	case reflect.Ptr:
-		field.Set(reflect.New(field.Type().Elem()))
-		return s.set(field.Elem(), value)
-	case reflect.Struct:
-		switch field.Type() {
-		case reflect.TypeOf(time.Time{}):
-			if t, err := time.Parse(time.RFC3339, value); err == nil {
-				s.setValue(field, t)
-			} else {
-				return ErrInvalidTimeFormat
-			}
+		ptr := reflect.New(field.Type().Elem())
+		if err := s.set(ptr.Elem(), value); err != nil {
+			return err
 		}
+
+		field.Set(ptr)
 	}
 
 	return nil
 }
 
-func (s *DefaultQueryBinder) setValue(field reflect.Value, value interface{}) {
-	field.Set(reflect.ValueOf(value))
+// parseQueryTag splits a query tag like "ids,required" into the param
+// name and its options.
+func parseQueryTag(tag string) (string, map[string]bool) {
+	parts := strings.Split(tag, ",")
+
+	options := make(map[string]bool, len(parts)-1)
+	for _, option := range parts[1:] {
+		options[strings.TrimSpace(option)] = true
+	}
+
+	return parts[0], options
+}
+
+// isQueryValue reports whether the struct or slice field is set from a
+// single param, like time.Time or a TextUnmarshaler, rather than from its
+// fields or items.
+func isQueryValue(field reflect.Value) bool {
+	if field.Type() == timeType {
+		return true
+	}
+
+	return field.CanAddr() && field.Addr().Type().Implements(textUnmarshalerType)
+}
+
+func nonEmpty(values []string) []string {
+	var out []string
+
+	for _, v := range values {
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+
+	return out
 }
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	testLevel int
+
+	testPage struct {
+		Page int `query:"page" default:"1"`
+	}
+
+	testQuery struct {
+		testPage
+
+		Name    string          `query:"name,required"`
+		IDs     []int           `query:"ids"`
+		Tags    []string        `query:"tag"`
+		Small   int8            `query:"small"`
+		Big     uint64          `query:"big"`
+		Ratio   float32         `query:"ratio"`
+		Active  bool            `query:"active"`
+		Level   testLevel       `query:"level"`
+		Limit   *uint16         `query:"limit"`
+		Wait    time.Duration   `query:"wait" default:"5s"`
+		Backoff []time.Duration `query:"backoff"`
+		Since   *time.Time      `query:"since"`
+		IP      net.IP          `query:"ip"`
+		Ignored string          `query:"-"`
+	}
+)
+
+func bindTestQuery(query string) (*testQuery, error) {
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/?"+query, nil), httptest.NewRecorder())
+
+	q := new(testQuery)
+
+	return q, BindQuery(c, q)
+}
+
+func TestBindQueryKinds(t *testing.T) {
+	q, err := bindTestQuery("name=bob&ids=1,2&ids=3&tag=a&tag=b,c&small=-128&big=18446744073709551615" +
+		"&ratio=1.5&active=true&level=4&limit=10&backoff=1s,1m&since=2020-01-02T03:04:05Z&ip=10.0.0.1&page=3&-=x")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limit := uint16(10)
+	since := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	want := &testQuery{
+		testPage: testPage{Page: 3},
+		Name:     "bob",
+		IDs:      []int{1, 2, 3},
+		Tags:     []string{"a", "b", "c"},
+		Small:    -128,
+		Big:      18446744073709551615,
+		Ratio:    1.5,
+		Active:   true,
+		Level:    4,
+		Limit:    &limit,
+		Wait:     5 * time.Second,
+		Backoff:  []time.Duration{time.Second, time.Minute},
+		Since:    &since,
+		IP:       net.ParseIP("10.0.0.1"),
+	}
+
+	if !reflect.DeepEqual(q, want) {
+		t.Errorf("got %+v, want %+v", q, want)
+	}
+}
+
+func TestBindQueryDefaultAndRequired(t *testing.T) {
+	q, err := bindTestQuery("name=bob&wait=&page=")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q.Page != 1 || q.Wait != 5*time.Second {
+		t.Errorf("got page %d and wait %s, want the defaults 1 and 5s", q.Page, q.Wait)
+	}
+
+	if _, err := bindTestQuery("ids=1"); !errors.Is(err, ErrMissingQueryParam) {
+		t.Errorf("missing required param: got %v, want %v", err, ErrMissingQueryParam)
+	}
+}
+
+func TestBindQueryInvalidValues(t *testing.T) {
+	tests := []struct {
+		query string
+		err   error
+	}{
+		{"name=bob&small=128", ErrInvalidNumberFormat},
+		{"name=bob&big=-1", ErrInvalidNumberFormat},
+		{"name=bob&ids=1,x", ErrInvalidNumberFormat},
+		{"name=bob&active=maybe", ErrInvalidBoolFormat},
+		{"name=bob&wait=soon", ErrInvalidDurationFormat},
+		{"name=bob&since=yesterday", ErrInvalidTimeFormat},
+	}
+
+	for _, tt := range tests {
+		if _, err := bindTestQuery(tt.query); err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.query, err, tt.err)
+		}
+	}
+
+	_, err := bindTestQuery("name=bob&ip=nope")
+
+	var he *echo.HTTPError
+	if !errors.As(err, &he) || he.Code != http.StatusBadRequest || he.Internal == nil {
+		t.Errorf("invalid TextUnmarshaler value: got %v, want a 400 with the parse error", err)
+	}
+}
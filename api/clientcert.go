@@ -0,0 +1,238 @@
+package api
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/zjeremiah/stdlib/auth"
+	"github.com/zjeremiah/stdlib/stats"
+)
+
+// Reasons a request can be rejected with by ClientCertAuth.
+const (
+	ReasonMissingCertificate = "missing_certificate"
+	ReasonInvalidCertificate = "invalid_certificate"
+	ReasonUnknownCertificate = "unknown_certificate"
+)
+
+// ErrEmptyCertMatch is returned for a CertIdentity that doesn't say which
+// certificates it matches.
+var ErrEmptyCertMatch = errors.New("cert identity matches no certificate field")
+
+type (
+	// CertMapping maps client certificates to identities. It is usually
+	// loaded from a JSON file of the form:
+	//
+	//  {
+	//  	"identities": [
+	//  		{"common_name": "billing", "id": "svc-billing", "roles": ["service"]},
+	//  		{"uri": "spiffe://example.org/reports", "username": "reports", "id": "svc-reports"}
+	//  	]
+	//  }
+	CertMapping struct {
+		Identities []CertIdentity `json:"identities"`
+	}
+
+	// CertIdentity is the identity of the certificates matching all of
+	// its CommonName, DNSName, URI and Email that are set. The DNSName,
+	// URI and Email are matched against the certificate's SANs. Username
+	// defaults to the certificate's common name.
+	CertIdentity struct {
+		CommonName string `json:"common_name"`
+		DNSName    string `json:"dns_name"`
+		URI        string `json:"uri"`
+		Email      string `json:"email"`
+
+		ID       string   `json:"id"`
+		Username string   `json:"username"`
+		Roles    []string `json:"roles"`
+	}
+
+	// ClientCertConfig configures ClientCertAuth.
+	ClientCertConfig struct {
+		Skipper middleware.Skipper
+
+		// ClientCAs are the CAs the client's certificate chain must be
+		// verified against, e.g. from xhttp.Config.ClientCAs. They are
+		// checked even if the TLS server verified the chain already.
+		// They are required; the system roots are never trusted.
+		ClientCAs *x509.CertPool
+
+		// Mapping is required.
+		Mapping *CertMapping
+
+		// Fallback is called for requests without a client certificate.
+		// They are rejected if it is nil.
+		Fallback echo.MiddlewareFunc
+
+		// Stats counts rejected certificates by reason. It may be nil.
+		Stats stats.Client
+	}
+)
+
+// LoadCertMapping reads a CertMapping from a JSON file.
+func LoadCertMapping(path string) (*CertMapping, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	mapping := new(CertMapping)
+	if err := json.Unmarshal(b, mapping); err != nil {
+		return nil, err
+	}
+
+	if err := mapping.validate(); err != nil {
+		return nil, err
+	}
+
+	return mapping, nil
+}
+
+// validate returns ErrEmptyCertMatch if an identity would match every
+// certificate.
+func (m *CertMapping) validate() error {
+	for _, identity := range m.Identities {
+		if identity.CommonName == "" && identity.DNSName == "" && identity.URI == "" && identity.Email == "" {
+			return ErrEmptyCertMatch
+		}
+	}
+
+	return nil
+}
+
+// Lookup returns the first identity matching the certificate.
+func (m *CertMapping) Lookup(cert *x509.Certificate) (*CertIdentity, bool) {
+	for i := range m.Identities {
+		if m.Identities[i].matches(cert) {
+			return &m.Identities[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// ClientCertAuth returns a middleware that authenticates requests by the
+// TLS client certificate. The chain is verified against the ClientCAs for
+// client authentication and the leaf certificate's identity is looked up
+// in the Mapping. It is stored with SetPrincipal, so handlers see the same
+// "username", "roles" and "id" values as with RMAuthJWT. The server must
+// request client certificates, see xhttp.Config.
+// It panics if ClientCAs or Mapping is nil, or if an identity of the
+// Mapping has nothing to match.
+func ClientCertAuth(config ClientCertConfig) echo.MiddlewareFunc {
+	if config.ClientCAs == nil {
+		panic("echo: client cert middleware requires client CAs")
+	}
+
+	if config.Mapping == nil {
+		panic("echo: client cert middleware requires a cert mapping")
+	}
+
+	if err := config.Mapping.validate(); err != nil {
+		panic("echo: client cert middleware: " + err.Error())
+	}
+
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+
+	if config.Stats == nil {
+		config.Stats = new(stats.NoOpClient)
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		var fallback echo.HandlerFunc
+		if config.Fallback != nil {
+			fallback = config.Fallback(next)
+		}
+
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			state := c.Request().TLS
+			if state == nil || len(state.PeerCertificates) == 0 {
+				if fallback != nil {
+					return fallback(c)
+				}
+
+				return rejectAuth(config.Stats, http.StatusUnauthorized, ReasonMissingCertificate, "missing client certificate", nil)
+			}
+
+			leaf := state.PeerCertificates[0]
+
+			intermediates := x509.NewCertPool()
+			for _, cert := range state.PeerCertificates[1:] {
+				intermediates.AddCert(cert)
+			}
+
+			_, err := leaf.Verify(x509.VerifyOptions{
+				Roots:         config.ClientCAs,
+				Intermediates: intermediates,
+				KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			})
+			if err != nil {
+				return rejectAuth(config.Stats, http.StatusUnauthorized, ReasonInvalidCertificate, "invalid client certificate", err)
+			}
+
+			identity, ok := config.Mapping.Lookup(leaf)
+			if !ok {
+				return rejectAuth(config.Stats, http.StatusForbidden, ReasonUnknownCertificate, "unknown client certificate", nil)
+			}
+
+			SetPrincipal(c, identity.principal(leaf))
+
+			return next(c)
+		}
+	}
+}
+
+func (i *CertIdentity) matches(cert *x509.Certificate) bool {
+	uris := make([]string, len(cert.URIs))
+	for j, uri := range cert.URIs {
+		uris[j] = uri.String()
+	}
+
+	return (i.CommonName == "" || i.CommonName == cert.Subject.CommonName) &&
+		(i.DNSName == "" || hasName(cert.DNSNames, i.DNSName)) &&
+		(i.URI == "" || hasName(uris, i.URI)) &&
+		(i.Email == "" || hasName(cert.EmailAddresses, i.Email))
+}
+
+// principal returns the principal of the identity, with the claims of a
+// JWT plus the certificate's "cert_subject".
+func (i *CertIdentity) principal(cert *x509.Certificate) *auth.Principal {
+	username := i.Username
+	if username == "" {
+		username = cert.Subject.CommonName
+	}
+
+	roles := make([]interface{}, len(i.Roles))
+	for j, role := range i.Roles {
+		roles[j] = role
+	}
+
+	return auth.NewPrincipal(map[string]interface{}{
+		"id":           i.ID,
+		"username":     username,
+		"roles":        roles,
+		"cert_subject": cert.Subject.String(),
+	})
+}
+
+func hasName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
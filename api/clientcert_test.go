@@ -0,0 +1,118 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func newTestCert(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	if parent == nil {
+		tpl.IsCA = true
+		parent, parentKey = tpl, key
+	} else {
+		tpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, key
+}
+
+func TestClientCertAuth(t *testing.T) {
+	ca, caKey := newTestCert(t, "ca", nil, nil)
+	billing, _ := newTestCert(t, "billing", ca, caKey)
+	unknown, _ := newTestCert(t, "unknown", ca, caKey)
+
+	otherCA, otherKey := newTestCert(t, "other ca", nil, nil)
+	forged, _ := newTestCert(t, "billing", otherCA, otherKey)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	mapping := &CertMapping{Identities: []CertIdentity{{CommonName: "billing", ID: "svc-billing"}}}
+
+	handler := ClientCertAuth(ClientCertConfig{ClientCAs: pool, Mapping: mapping})(func(c echo.Context) error {
+		return c.String(http.StatusOK, c.Get("id").(string))
+	})
+
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+		code int
+	}{
+		{"known", billing, http.StatusOK},
+		{"unknown", unknown, http.StatusForbidden},
+		{"other ca", forged, http.StatusUnauthorized},
+		{"missing", nil, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.cert != nil {
+			req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{tt.cert}}
+		}
+
+		if code := serveStatus(t, handler, req); code != tt.code {
+			t.Errorf("%s: got status %d, want %d", tt.name, code, tt.code)
+		}
+	}
+}
+
+func TestClientCertAuthRequiresConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config ClientCertConfig
+	}{
+		{"no client cas", ClientCertConfig{Mapping: new(CertMapping)}},
+		{"no mapping", ClientCertConfig{ClientCAs: x509.NewCertPool()}},
+		{"empty identity", ClientCertConfig{
+			ClientCAs: x509.NewCertPool(),
+			Mapping:   &CertMapping{Identities: []CertIdentity{{ID: "everyone"}}},
+		}},
+	}
+
+	for _, tt := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: ClientCertAuth did not panic", tt.name)
+				}
+			}()
+
+			ClientCertAuth(tt.config)
+		}()
+	}
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+)
+
+// EnvironmentVar names the environment variable holding the deployment
+// environment, e.g. "production" or "development".
+const EnvironmentVar = "APP_ENV"
+
+// DefaultDevTokenTTL is the lifetime of tokens minted by DevTokenHandler.
+const DefaultDevTokenTTL = time.Hour
+
+// ErrDevmodeInProduction is returned by SetupAuth when Devmode is set in production.
+var ErrDevmodeInProduction = errors.New("devmode is not allowed in production")
+
+// ProductionEnvironments are the values of EnvironmentVar, compared
+// case-insensitively, that IsProduction recognizes.
+var ProductionEnvironments = []string{"production", "prod"}
+
+type (
+	// DevTokenRequest is the body DevTokenHandler accepts. Every field is
+	// optional; the user is "dev" with id 1 and no roles by default.
+	DevTokenRequest struct {
+		Username string                 `json:"username"`
+		ID       interface{}            `json:"id"`
+		Roles    []string               `json:"roles"`
+		Claims   map[string]interface{} `json:"claims"`
+	}
+
+	// DevTokenResponse is the body DevTokenHandler answers with.
+	DevTokenResponse struct {
+		Token string `json:"token"`
+	}
+)
+
+// IsProduction reports whether EnvironmentVar names a production environment.
+func IsProduction() bool {
+	env := strings.TrimSpace(os.Getenv(EnvironmentVar))
+
+	for _, prod := range ProductionEnvironments {
+		if strings.EqualFold(env, prod) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DevTokenHandler returns a handler minting tokens signed with
+// DevSigningKey that the middleware from SetupAuth accepts in Devmode.
+// The tokens carry "username", "id" and "roles" as well as the Issuer
+// and Audience the options require. Unless the options are in Devmode
+// and IsProduction is false, the handler responds 404 Not Found. It is
+// only served if registered, e.g.
+//
+//	e.POST("/dev/token", api.DevTokenHandler(opts))
+func DevTokenHandler(opts *AuthOptions) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !opts.Devmode || IsProduction() {
+			return echo.ErrNotFound
+		}
+
+		req := new(DevTokenRequest)
+		if c.Request().ContentLength != 0 {
+			if err := c.Bind(req); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+
+		claims := jwt.MapClaims{
+			"username": "dev",
+			"id":       1,
+			"roles":    []string{},
+			"iat":      now.Unix(),
+			"exp":      now.Add(DefaultDevTokenTTL).Unix(),
+		}
+
+		if opts.Issuer != "" {
+			claims["iss"] = opts.Issuer
+		}
+
+		if opts.Audience != "" {
+			claims["aud"] = opts.Audience
+		}
+
+		for k, v := range req.Claims {
+			claims[k] = v
+		}
+
+		if req.Username != "" {
+			claims["username"] = req.Username
+		}
+
+		if req.ID != nil {
+			claims["id"] = req.ID
+		}
+
+		if req.Roles != nil {
+			claims["roles"] = req.Roles
+		}
+
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(DevSigningKey)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, &DevTokenResponse{Token: token})
+	}
+}
+
+func newDevSigningKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic("could not generate dev signing key: " + err.Error())
+	}
+
+	return key
+}
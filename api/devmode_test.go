@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/zjeremiah/stdlib/auth"
+)
+
+func TestIsProduction(t *testing.T) {
+	tests := []struct {
+		env  string
+		want bool
+	}{
+		{"", false},
+		{"development", false},
+		{"staging", false},
+		{"production", true},
+		{" PROD ", true},
+	}
+
+	for _, tt := range tests {
+		t.Setenv(EnvironmentVar, tt.env)
+
+		if got := IsProduction(); got != tt.want {
+			t.Errorf("%q: got %v, want %v", tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestSetupAuthRefusesDevmodeInProduction(t *testing.T) {
+	t.Setenv(EnvironmentVar, "production")
+
+	if _, _, err := SetupAuth(&AuthOptions{Devmode: true}, nil, nil); err != ErrDevmodeInProduction {
+		t.Errorf("got %v, want %v", err, ErrDevmodeInProduction)
+	}
+}
+
+// devToken requests a token from the handler and returns the response
+// status and the token.
+func devToken(t *testing.T, handler echo.HandlerFunc, body string) (int, string) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/dev/token", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+	rec := httptest.NewRecorder()
+
+	err := handler(echo.New().NewContext(req, rec))
+	if he, ok := err.(*echo.HTTPError); ok {
+		return he.Code, ""
+	} else if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := new(DevTokenResponse)
+	if err := json.Unmarshal(rec.Body.Bytes(), resp); err != nil {
+		t.Fatal(err)
+	}
+
+	return rec.Code, resp.Token
+}
+
+func TestDevTokenHandler(t *testing.T) {
+	t.Setenv(EnvironmentVar, "development")
+
+	opts := &AuthOptions{Devmode: true, Issuer: "https://auth.example.com", Audience: "app"}
+
+	_, mw, err := SetupAuth(opts, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var p *auth.Principal
+
+	handler := mw(func(c echo.Context) error {
+		p, _ = PrincipalFrom(c)
+		return c.NoContent(http.StatusOK)
+	})
+
+	code, token := devToken(t, DevTokenHandler(opts), `{"username": "alice", "roles": ["admin"], "claims": {"tenant": "acme"}}`)
+	if code != http.StatusOK {
+		t.Fatalf("got status %d, want 200", code)
+	}
+
+	if code := serveStatus(t, handler, bearerRequest(http.MethodGet, token)); code != http.StatusOK {
+		t.Fatalf("dev token: got status %d, want 200", code)
+	}
+
+	if tenant, _ := p.Claim("tenant"); p.Username != "alice" || p.ID != "1" || !p.HasRole("admin") || tenant != "acme" {
+		t.Errorf("got principal %+v", p)
+	}
+
+	if code, token = devToken(t, DevTokenHandler(opts), ""); code != http.StatusOK {
+		t.Fatalf("empty body: got status %d, want 200", code)
+	}
+
+	if code := serveStatus(t, handler, bearerRequest(http.MethodGet, token)); code != http.StatusOK || p.Username != "dev" {
+		t.Errorf("default dev token: got status %d and principal %+v", code, p)
+	}
+
+	if len(DevSigningKey) != 32 {
+		t.Errorf("got a %d byte dev signing key, want 32 random bytes", len(DevSigningKey))
+	}
+
+	// Tokens not signed with this process's DevSigningKey are refused.
+	if code := serveStatus(t, handler, bearerRequest(http.MethodGet, signedWith(t, []byte("secret")))); code != http.StatusUnauthorized {
+		t.Errorf("token signed with another key: got status %d, want 401", code)
+	}
+
+	if code, _ := devToken(t, DevTokenHandler(&AuthOptions{}), ""); code != http.StatusNotFound {
+		t.Errorf("without devmode: got status %d, want 404", code)
+	}
+
+	t.Setenv(EnvironmentVar, "production")
+
+	if code, _ := devToken(t, DevTokenHandler(opts), ""); code != http.StatusNotFound {
+		t.Errorf("in production: got status %d, want 404", code)
+	}
+}
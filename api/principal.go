@@ -0,0 +1,39 @@
+package api
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/zjeremiah/stdlib/auth"
+)
+
+// PrincipalContextKey is the echo context key the authenticated
+// auth.Principal is stored under.
+const PrincipalContextKey = "principal"
+
+// PrincipalFrom returns the principal authenticated for this request.
+func PrincipalFrom(c echo.Context) (*auth.Principal, bool) {
+	p, ok := c.Get(PrincipalContextKey).(*auth.Principal)
+	return p, ok && p != nil
+}
+
+// SetPrincipal stores the principal on the echo context and on the
+// request's context.Context, so code that only sees the request context
+// can use auth.PrincipalFromContext. The principal's Username, Roles and
+// ID are set as the "username", "roles" and "id" context values as well,
+// so they are there for OpenID Connect tokens too. Roles is always set,
+// as a []string, and ID is a string, whatever their type in the claims.
+func SetPrincipal(c echo.Context, p *auth.Principal) {
+	c.Set(PrincipalContextKey, p)
+
+	if p.Username != "" {
+		c.Set("username", p.Username)
+	}
+
+	c.Set("roles", p.Roles)
+
+	if p.ID != "" {
+		c.Set("id", p.ID)
+	}
+
+	req := c.Request()
+	c.SetRequest(req.WithContext(auth.WithPrincipal(req.Context(), p)))
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/zjeremiah/stdlib/auth"
+)
+
+func TestRMAuthJWTSetsPrincipal(t *testing.T) {
+	var (
+		p       *auth.Principal
+		fromCtx *auth.Principal
+		roles   interface{}
+	)
+
+	handler := RMAuthJWT(testJWTConfig())(func(c echo.Context) error {
+		p, _ = PrincipalFrom(c)
+		fromCtx, _ = auth.PrincipalFromContext(c.Request().Context())
+		roles = c.Get("roles")
+
+		return c.NoContent(http.StatusOK)
+	})
+
+	token := testToken(t, map[string]interface{}{"id": 7, "roles": "admin,user"})
+
+	if code := serveStatus(t, handler, bearerRequest(http.MethodGet, token)); code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", code, http.StatusOK)
+	}
+
+	if p == nil {
+		t.Fatal("no principal on the echo context")
+	}
+
+	if p.ID != "7" || p.Username != "bob" || !p.HasRole("user") {
+		t.Errorf("got principal %+v", p)
+	}
+
+	if fromCtx != p {
+		t.Errorf("got request context principal %v, want %v", fromCtx, p)
+	}
+
+	if !reflect.DeepEqual(roles, []string{"admin", "user"}) {
+		t.Errorf("got roles context value %#v", roles)
+	}
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/zjeremiah/stdlib/auth"
+	"github.com/zjeremiah/stdlib/xhttp"
+)
+
+var (
+	// ErrNoTokenToRelay is returned when the request was not authenticated
+	// with a bearer token, e.g. it used an API key.
+	ErrNoTokenToRelay = errors.New("request has no bearer token to relay")
+
+	// ErrHostNotAllowed is returned when a relayed token would be sent
+	// to a host outside the relay's allowlist.
+	ErrHostNotAllowed = errors.New("host is not allowed to receive relayed tokens")
+
+	// ErrInsecureRelay is returned when a relayed token would be sent
+	// over plain http.
+	ErrInsecureRelay = errors.New("relayed tokens are only sent over https")
+)
+
+type (
+	// TokenRelay builds xhttp.Clients that forward the bearer token a
+	// request was authenticated with by RMAuthJWT to other services.
+	// Tokens are only ever sent over https to hosts in the allowlist.
+	TokenRelay struct {
+		client       xhttp.Client
+		allowedHosts []string
+
+		// Exchanger, if set, swaps the incoming token for one restricted
+		// to Audience and Scopes before it is forwarded.
+		Exchanger auth.TokenExchanger
+		Audience  string
+		Scopes    []string
+	}
+
+	relayClient struct {
+		relay *TokenRelay
+		ctx   context.Context
+		token auth.Token
+	}
+)
+
+// NewTokenRelay returns a TokenRelay sending requests through client to
+// the allowed hosts. A host is either a hostname, matched exactly, or
+// "*.example.com", matching any subdomain of example.com.
+func NewTokenRelay(client xhttp.Client, allowedHosts ...string) *TokenRelay {
+	return &TokenRelay{
+		client:       client,
+		allowedHosts: allowedHosts,
+	}
+}
+
+// EchoClient returns a client forwarding the token of the echo request.
+func (r *TokenRelay) EchoClient(c echo.Context) (xhttp.Client, error) {
+	p, ok := PrincipalFrom(c)
+	if !ok {
+		return nil, ErrNoTokenToRelay
+	}
+
+	return r.clientFor(c.Request().Context(), p)
+}
+
+// Client returns a client forwarding the token of the principal stored
+// in ctx. Requests made with Get, Head, Post and PostForm are bound to ctx.
+func (r *TokenRelay) Client(ctx context.Context) (xhttp.Client, error) {
+	p, ok := auth.PrincipalFromContext(ctx)
+	if !ok {
+		return nil, ErrNoTokenToRelay
+	}
+
+	return r.clientFor(ctx, p)
+}
+
+// Allowed reports whether tokens may be sent to the host.
+func (r *TokenRelay) Allowed(host string) bool {
+	host = strings.ToLower(host)
+
+	for _, allowed := range r.allowedHosts {
+		allowed = strings.ToLower(allowed)
+
+		if strings.HasPrefix(allowed, "*.") {
+			if strings.HasSuffix(host, allowed[1:]) {
+				return true
+			}
+		} else if host == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *TokenRelay) clientFor(ctx context.Context, p *auth.Principal) (xhttp.Client, error) {
+	if len(p.Token) == 0 {
+		return nil, ErrNoTokenToRelay
+	}
+
+	token := p.Token
+
+	if r.Exchanger != nil {
+		exchanged, err := r.Exchanger.ExchangeToken(token, r.Audience, r.Scopes)
+		if err != nil {
+			return nil, err
+		}
+
+		token = exchanged
+	}
+
+	return &relayClient{
+		relay: r,
+		ctx:   ctx,
+		token: token,
+	}, nil
+}
+
+// Do sends the request with the relayed token if it is an https request
+// to an allowed host.
+func (c *relayClient) Do(req *http.Request) (*http.Response, error) {
+	if !strings.EqualFold(req.URL.Scheme, "https") {
+		return nil, ErrInsecureRelay
+	}
+
+	if !c.relay.Allowed(req.URL.Hostname()) {
+		return nil, ErrHostNotAllowed
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+c.token.String())
+
+	return c.relay.client.Do(req)
+}
+
+func (c *relayClient) Get(u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(c.ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Do(req)
+}
+
+func (c *relayClient) Head(u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(c.ctx, "HEAD", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Do(req)
+}
+
+func (c *relayClient) Post(u, bodyType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(c.ctx, "POST", u, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", bodyType)
+
+	return c.Do(req)
+}
+
+func (c *relayClient) PostForm(u string, data url.Values) (*http.Response, error) {
+	return c.Post(u, "application/x-www-form-urlencoded", strings.NewReader(data.Encode()))
+}
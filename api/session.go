@@ -0,0 +1,301 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/zjeremiah/stdlib/auth"
+)
+
+// Reasons a login can be refused with by LoginHandler.
+const (
+	ReasonInvalidLogin     = "invalid_login"
+	ReasonLockedOut        = "locked_out"
+	ReasonInvalidMFACode   = "invalid_mfa_code"
+	ReasonInvalidChallenge = "invalid_challenge"
+)
+
+// ReasonInvalidCSRFToken is the reason CSRF rejects requests with.
+const ReasonInvalidCSRFToken = "invalid_csrf_token"
+
+const (
+	// DefaultSessionCookie is the cookie LoginHandler stores the token in.
+	DefaultSessionCookie = "session"
+
+	// DefaultCSRFCookie is the cookie holding the CSRF token.
+	DefaultCSRFCookie = "_csrf"
+)
+
+type (
+	// SessionConfig configures cookie sessions: LoginHandler,
+	// LogoutHandler and CSRF. Use the same config for all three and set
+	// RMAuthJWTConfig.CookieName to its CookieName.
+	SessionConfig struct {
+		Provider auth.Provider
+
+		// CookieName is the HttpOnly cookie holding the token. It defaults
+		// to DefaultSessionCookie.
+		CookieName string
+
+		// CSRFCookieName is the cookie holding the CSRF token, readable by
+		// scripts so they can send it back in the X-CSRF-Token header. It
+		// defaults to DefaultCSRFCookie.
+		CSRFCookieName string
+
+		CookieDomain string
+
+		// CookiePath defaults to "/".
+		CookiePath string
+
+		// SameSite defaults to http.SameSiteLaxMode.
+		SameSite http.SameSite
+
+		// Insecure drops the Secure attribute from the cookies, for
+		// development over plain http only.
+		Insecure bool
+	}
+
+	// LoginRequest is the body LoginHandler accepts, as JSON or a form.
+	LoginRequest struct {
+		Username string `json:"username" form:"username"`
+		Password string `json:"password" form:"password"`
+	}
+
+	// LoginResponse is the body LoginHandler answers a successful login
+	// with. If the Provider requires MFA, it only carries the Challenge to
+	// send to VerifyMFAHandler with the user's code.
+	LoginResponse struct {
+		CSRFToken   string `json:"csrf_token,omitempty"`
+		MFARequired bool   `json:"mfa_required,omitempty"`
+		Challenge   string `json:"challenge,omitempty"`
+	}
+
+	// VerifyMFARequest is the body VerifyMFAHandler accepts, as JSON or a form.
+	VerifyMFARequest struct {
+		Challenge string `json:"challenge" form:"challenge"`
+		Code      string `json:"code" form:"code"`
+	}
+)
+
+// LoginHandler logs the user in with the Provider and stores the token in
+// the session cookie, expiring with the token. A new CSRF token is set as
+// well and returned in the LoginResponse. Invalid logins get a 401 and
+// locked out users a 429 with Retry-After, both with an AuthError body.
+// If the Provider is an auth.MFAProvider requiring a second factor, no
+// cookies are set and the LoginResponse carries the MFA challenge.
+func LoginHandler(config SessionConfig) echo.HandlerFunc {
+	config = config.withDefaults()
+
+	return func(c echo.Context) error {
+		login := new(LoginRequest)
+		if err := c.Bind(login); err != nil {
+			return err
+		}
+
+		token, err := config.login(c, login)
+
+		var challenge *auth.MFAChallengeError
+		if errors.As(err, &challenge) {
+			return c.JSON(http.StatusOK, &LoginResponse{MFARequired: true, Challenge: challenge.Challenge})
+		}
+
+		if err != nil {
+			return loginError(c, err)
+		}
+
+		return config.startSession(c, token)
+	}
+}
+
+// VerifyMFAHandler answers the MFA challenge returned by LoginHandler with
+// the user's code and, if it is valid, starts the session like LoginHandler.
+// The Provider must be an auth.MFAProvider. Invalid codes and challenges
+// get a 401 and locked out users a 429 with Retry-After.
+func VerifyMFAHandler(config SessionConfig) echo.HandlerFunc {
+	config = config.withDefaults()
+
+	return func(c echo.Context) error {
+		verify := new(VerifyMFARequest)
+		if err := c.Bind(verify); err != nil {
+			return err
+		}
+
+		provider, ok := config.Provider.(auth.MFAProvider)
+		if !ok {
+			return echo.ErrNotFound
+		}
+
+		token, err := provider.VerifyMFA(verify.Challenge, verify.Code)
+		if err != nil {
+			return loginError(c, err)
+		}
+
+		return config.startSession(c, token)
+	}
+}
+
+// LogoutHandler clears the session and CSRF cookies.
+func LogoutHandler(config SessionConfig) echo.HandlerFunc {
+	config = config.withDefaults()
+
+	return func(c echo.Context) error {
+		for _, name := range []string{config.CookieName, config.CSRFCookieName} {
+			cookie := config.cookie(name, "")
+			cookie.MaxAge = -1
+			c.SetCookie(cookie)
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// CSRF returns double-submit CSRF middleware: unsafe requests must send
+// the value of the CSRF cookie in the X-CSRF-Token header. Only requests
+// carrying the session cookie are checked, as clients sending their token
+// in the Authorization header can't be forged by another site. Requests
+// with a missing or wrong token are rejected with a 403.
+func CSRF(config SessionConfig) echo.MiddlewareFunc {
+	config = config.withDefaults()
+
+	csrf := middleware.CSRFWithConfig(middleware.CSRFConfig{
+		Skipper: func(c echo.Context) bool {
+			_, err := c.Cookie(config.CookieName)
+			return err != nil
+		},
+		CookieName:     config.CSRFCookieName,
+		CookieDomain:   config.CookieDomain,
+		CookiePath:     config.CookiePath,
+		CookieSecure:   !config.Insecure,
+		CookieSameSite: config.SameSite,
+	})
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			passed := false
+
+			err := csrf(func(c echo.Context) error {
+				passed = true
+				return next(c)
+			})(c)
+
+			// The echo middleware answers a missing token with a 400.
+			if he, ok := err.(*echo.HTTPError); ok && !passed {
+				return &echo.HTTPError{
+					Code:     http.StatusForbidden,
+					Message:  newAuthError(ReasonInvalidCSRFToken, "missing or invalid csrf token", nil),
+					Internal: he,
+				}
+			}
+
+			return err
+		}
+	}
+}
+
+func (config SessionConfig) withDefaults() SessionConfig {
+	if config.CookieName == "" {
+		config.CookieName = DefaultSessionCookie
+	}
+
+	if config.CSRFCookieName == "" {
+		config.CSRFCookieName = DefaultCSRFCookie
+	}
+
+	if config.CookiePath == "" {
+		config.CookiePath = "/"
+	}
+
+	if config.SameSite == 0 {
+		config.SameSite = http.SameSiteLaxMode
+	}
+
+	return config
+}
+
+func (config SessionConfig) login(c echo.Context, login *LoginRequest) (auth.Token, error) {
+	if p, ok := config.Provider.(auth.IPLoginProvider); ok {
+		return p.LoginFrom(c.RealIP(), login.Username, login.Password)
+	}
+
+	return config.Provider.Login(login.Username, login.Password)
+}
+
+// startSession sets the session cookie for the token and a new CSRF token.
+func (config SessionConfig) startSession(c echo.Context, token auth.Token) error {
+	session := config.cookie(config.CookieName, token.String())
+	session.HttpOnly = true
+	session.Expires = auth.TokenExpiry(token)
+	c.SetCookie(session)
+
+	csrfToken, err := newCSRFToken()
+	if err != nil {
+		return err
+	}
+
+	c.SetCookie(config.cookie(config.CSRFCookieName, csrfToken))
+
+	return c.JSON(http.StatusOK, &LoginResponse{CSRFToken: csrfToken})
+}
+
+// loginError turns a refused login or MFA verification into an HTTPError.
+func loginError(c echo.Context, err error) error {
+	var lockedOut *auth.LockedOutError
+
+	switch {
+	case errors.As(err, &lockedOut):
+		retryAfter := int(time.Until(lockedOut.Until)/time.Second) + 1
+		c.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(retryAfter))
+
+		return &echo.HTTPError{
+			Code:     http.StatusTooManyRequests,
+			Message:  newAuthError(ReasonLockedOut, "too many failed logins", nil),
+			Internal: err,
+		}
+	case errors.Is(err, auth.ErrInvalidLogin):
+		return &echo.HTTPError{
+			Code:     http.StatusUnauthorized,
+			Message:  newAuthError(ReasonInvalidLogin, "invalid username or password", nil),
+			Internal: err,
+		}
+	case errors.Is(err, auth.ErrInvalidMFACode), errors.Is(err, auth.ErrNotEnrolled):
+		return &echo.HTTPError{
+			Code:     http.StatusUnauthorized,
+			Message:  newAuthError(ReasonInvalidMFACode, "invalid mfa code", nil),
+			Internal: err,
+		}
+	case errors.Is(err, auth.ErrInvalidChallenge):
+		return &echo.HTTPError{
+			Code:     http.StatusUnauthorized,
+			Message:  newAuthError(ReasonInvalidChallenge, "invalid or expired mfa challenge, log in again", nil),
+			Internal: err,
+		}
+	default:
+		return err
+	}
+}
+
+func (config SessionConfig) cookie(name, value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Domain:   config.CookieDomain,
+		Path:     config.CookiePath,
+		Secure:   !config.Insecure,
+		SameSite: config.SameSite,
+	}
+}
+
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/zjeremiah/stdlib/auth"
+)
+
+// loginErrorProvider refuses every login with err.
+type loginErrorProvider struct {
+	auth.Provider
+	err error
+}
+
+func (p *loginErrorProvider) Login(username, password string) (auth.Token, error) {
+	return nil, p.err
+}
+
+// login posts a login to the handler and returns the response.
+func login(t *testing.T, handler echo.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"username": "bob", "password": "secret"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+
+	if err := handler(c); err != nil {
+		c.Echo().HTTPErrorHandler(err, c)
+	}
+
+	return rec
+}
+
+func responseCookies(rec *httptest.ResponseRecorder) map[string]*http.Cookie {
+	cookies := make(map[string]*http.Cookie)
+	for _, cookie := range rec.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+
+	return cookies
+}
+
+func TestLoginHandlerSetsCookies(t *testing.T) {
+	rec := login(t, LoginHandler(SessionConfig{Provider: auth.NewFakeProvider(testSigningKey)}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200", rec.Code)
+	}
+
+	resp := new(LoginResponse)
+	if err := json.Unmarshal(rec.Body.Bytes(), resp); err != nil {
+		t.Fatal(err)
+	}
+
+	cookies := responseCookies(rec)
+
+	session, csrf := cookies[DefaultSessionCookie], cookies[DefaultCSRFCookie]
+	if session == nil || csrf == nil {
+		t.Fatalf("got cookies %v, want %s and %s", cookies, DefaultSessionCookie, DefaultCSRFCookie)
+	}
+
+	if !session.HttpOnly || !session.Secure || session.SameSite != http.SameSiteLaxMode || session.Path != "/" {
+		t.Errorf("got session cookie %+v, want HttpOnly, Secure, SameSite=Lax and Path=/", session)
+	}
+
+	if until := time.Until(session.Expires); until < 23*time.Hour || until > 25*time.Hour {
+		t.Errorf("got session cookie expiring in %v, want it to expire with the token", until)
+	}
+
+	if csrf.HttpOnly || !csrf.Secure || csrf.SameSite != http.SameSiteLaxMode {
+		t.Errorf("got csrf cookie %+v, want a Secure SameSite=Lax cookie readable by scripts", csrf)
+	}
+
+	if resp.CSRFToken == "" || resp.CSRFToken != csrf.Value {
+		t.Errorf("got csrf token %q, want the csrf cookie's %q", resp.CSRFToken, csrf.Value)
+	}
+
+	rec = login(t, LoginHandler(SessionConfig{
+		Provider:   auth.NewFakeProvider(testSigningKey),
+		CookieName: "token",
+		SameSite:   http.SameSiteStrictMode,
+		Insecure:   true,
+	}))
+
+	session = responseCookies(rec)["token"]
+	if session == nil || session.Secure || session.SameSite != http.SameSiteStrictMode {
+		t.Errorf("got session cookie %+v, want an insecure SameSite=Strict cookie named token", session)
+	}
+}
+
+func TestLoginHandlerRefusals(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code int
+	}{
+		{"invalid login", auth.ErrInvalidLogin, http.StatusUnauthorized},
+		{"locked out", &auth.LockedOutError{Until: time.Now().Add(time.Minute)}, http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		rec := login(t, LoginHandler(SessionConfig{Provider: &loginErrorProvider{err: tt.err}}))
+
+		if rec.Code != tt.code {
+			t.Errorf("%s: got status %d, want %d", tt.name, rec.Code, tt.code)
+		}
+
+		if cookies := rec.Result().Cookies(); len(cookies) > 0 {
+			t.Errorf("%s: got cookies %v, want none", tt.name, cookies)
+		}
+	}
+
+	rec := login(t, LoginHandler(SessionConfig{Provider: &loginErrorProvider{err: &auth.LockedOutError{Until: time.Now().Add(time.Minute)}}}))
+	if retryAfter := rec.Header().Get(echo.HeaderRetryAfter); retryAfter != "60" && retryAfter != "61" {
+		t.Errorf("got Retry-After %q, want about 60", retryAfter)
+	}
+}
+
+func TestLogoutHandlerClearsCookies(t *testing.T) {
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/logout", nil), rec)
+
+	if err := LogoutHandler(SessionConfig{})(c); err != nil {
+		t.Fatal(err)
+	}
+
+	cookies := responseCookies(rec)
+
+	for _, name := range []string{DefaultSessionCookie, DefaultCSRFCookie} {
+		if cookie := cookies[name]; cookie == nil || cookie.MaxAge >= 0 || cookie.Value != "" {
+			t.Errorf("got %s cookie %+v, want it deleted", name, cookie)
+		}
+	}
+}
+
+func TestCSRF(t *testing.T) {
+	config := SessionConfig{}
+
+	jwtConfig := testJWTConfig()
+	jwtConfig.CookieName = DefaultSessionCookie
+
+	handler := CSRF(config)(RMAuthJWT(jwtConfig)(okHandler))
+
+	token := testToken(t, nil)
+
+	request := func(method, csrfHeader string) *http.Request {
+		req := httptest.NewRequest(method, "/", nil)
+		req.AddCookie(&http.Cookie{Name: DefaultSessionCookie, Value: token})
+		req.AddCookie(&http.Cookie{Name: DefaultCSRFCookie, Value: "csrf-token"})
+
+		if csrfHeader != "" {
+			req.Header.Set(echo.HeaderXCSRFToken, csrfHeader)
+		}
+
+		return req
+	}
+
+	tests := []struct {
+		name string
+		req  *http.Request
+		code int
+	}{
+		{"matching token", request(http.MethodPost, "csrf-token"), http.StatusOK},
+		{"missing token", request(http.MethodPost, ""), http.StatusForbidden},
+		{"wrong token", request(http.MethodDelete, "other-token"), http.StatusForbidden},
+		{"safe method", request(http.MethodGet, ""), http.StatusOK},
+		{"bearer token", bearerRequest(http.MethodPost, token), http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		if code := serveStatus(t, handler, tt.req); code != tt.code {
+			t.Errorf("%s: got status %d, want %d", tt.name, code, tt.code)
+		}
+	}
+
+	// Errors of the protected handler itself pass through unchanged.
+	failing := CSRF(config)(func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusBadRequest)
+	})
+
+	if code := serveStatus(t, failing, request(http.MethodPost, "csrf-token")); code != http.StatusBadRequest {
+		t.Errorf("handler error: got status %d, want 400", code)
+	}
+}
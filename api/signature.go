@@ -0,0 +1,231 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/zjeremiah/stdlib/stats"
+	"github.com/zjeremiah/stdlib/xhttp"
+)
+
+// Reasons a request can be rejected with by VerifySignature.
+const (
+	ReasonMissingSignature = "missing_signature"
+	ReasonInvalidSignature = "invalid_signature"
+	ReasonStaleSignature   = "stale_signature"
+	ReasonReplayedRequest  = "replayed_request"
+	ReasonBodyTooLarge     = "body_too_large"
+)
+
+const (
+	// DefaultSignatureWindow is how far a signed request's timestamp may
+	// be from the current time.
+	DefaultSignatureWindow = 5 * time.Minute
+
+	// DefaultSignatureMaxBodySize is the largest body VerifySignature
+	// reads to verify a request, in bytes.
+	DefaultSignatureMaxBodySize = 1 << 20
+
+	// SignatureKeyIDContextKey is the echo context key the ID of the key
+	// that verified a request is stored under.
+	SignatureKeyIDContextKey = "signature_key_id"
+)
+
+type (
+	// NonceCache remembers the nonces of verified requests to reject replays.
+	NonceCache interface {
+		// Add remembers the nonce until expiresAt. It returns false if
+		// the nonce was added before and has not expired.
+		Add(nonce string, expiresAt time.Time) (bool, error)
+	}
+
+	// SignatureConfig configures VerifySignature.
+	SignatureConfig struct {
+		Skipper middleware.Skipper
+
+		// Keys are the keys a request may be signed with. During a
+		// rotation, list both the old and the new key.
+		Keys []xhttp.SigningKey
+
+		// Window is how far a request's timestamp may be from the current
+		// time. It defaults to DefaultSignatureWindow.
+		Window time.Duration
+
+		// MaxBodySize is the largest body that is read to verify the
+		// signature, in bytes. Larger requests are rejected with a 413.
+		// It defaults to DefaultSignatureMaxBodySize.
+		MaxBodySize int64
+
+		// Nonces rejects replays within the window. It defaults to a cache
+		// in memory; use a shared one if several replicas receive requests.
+		Nonces NonceCache
+
+		// Stats receives the webhook_signature_rejected counter. It may be nil.
+		Stats stats.Client
+	}
+
+	memoryNonceCache struct {
+		mu        sync.Mutex
+		nonces    map[string]time.Time
+		nextPrune time.Time
+	}
+)
+
+// VerifySignature returns a middleware that verifies requests signed by
+// an xhttp.SigningClient with one of the Keys. Requests that aren't signed
+// correctly, whose timestamp is outside the Window or whose nonce was seen
+// before are rejected with a 401, and bodies over MaxBodySize with a 413.
+// Rejections are counted in webhook_signature_rejected.
+// The ID of the verifying key is stored on the context under
+// SignatureKeyIDContextKey.
+func VerifySignature(config SignatureConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+
+	if config.Window == 0 {
+		config.Window = DefaultSignatureWindow
+	}
+
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = DefaultSignatureMaxBodySize
+	}
+
+	if config.Nonces == nil {
+		config.Nonces = NewMemoryNonceCache()
+	}
+
+	if config.Stats == nil {
+		config.Stats = new(stats.NoOpClient)
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			req := c.Request()
+
+			signature := req.Header.Get(xhttp.HeaderSignature)
+			timestamp := req.Header.Get(xhttp.HeaderSignatureTimestamp)
+			nonce := req.Header.Get(xhttp.HeaderSignatureNonce)
+
+			if signature == "" || timestamp == "" || nonce == "" {
+				return config.reject(http.StatusUnauthorized, ReasonMissingSignature, "missing request signature", nil)
+			}
+
+			unix, err := strconv.ParseInt(timestamp, 10, 64)
+			if err != nil {
+				return config.reject(http.StatusUnauthorized, ReasonInvalidSignature, "invalid request signature", err)
+			}
+
+			signedAt := time.Unix(unix, 0)
+			if age := time.Since(signedAt); age > config.Window || age < -config.Window {
+				return config.reject(http.StatusUnauthorized, ReasonStaleSignature, "request signature is too old", nil)
+			}
+
+			body, err := ioutil.ReadAll(io.LimitReader(req.Body, config.MaxBodySize+1))
+			if err != nil {
+				return err
+			}
+
+			if int64(len(body)) > config.MaxBodySize {
+				return config.reject(http.StatusRequestEntityTooLarge, ReasonBodyTooLarge, "request body is too large", nil)
+			}
+
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			keyID, ok := config.verify(signature, req.Method, req.URL.RequestURI(), timestamp, nonce, body)
+			if !ok {
+				return config.reject(http.StatusUnauthorized, ReasonInvalidSignature, "invalid request signature", nil)
+			}
+
+			fresh, err := config.Nonces.Add(nonce, signedAt.Add(config.Window))
+			if err != nil {
+				return err
+			}
+
+			if !fresh {
+				return config.reject(http.StatusUnauthorized, ReasonReplayedRequest, "request was replayed", nil)
+			}
+
+			c.Set(SignatureKeyIDContextKey, keyID)
+
+			return next(c)
+		}
+	}
+}
+
+// verify returns the ID of a key that one of the signatures matches.
+func (config *SignatureConfig) verify(signatures, method, uri, timestamp, nonce string, body []byte) (string, bool) {
+	for _, pair := range strings.Split(signatures, ",") {
+		i := strings.IndexByte(pair, '=')
+		if i < 0 {
+			continue
+		}
+
+		id, signature := strings.TrimSpace(pair[:i]), strings.TrimSpace(pair[i+1:])
+
+		for _, key := range config.Keys {
+			if key.ID != id {
+				continue
+			}
+
+			expected := xhttp.RequestSignature(key.Secret, method, uri, timestamp, nonce, body)
+			if hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+				return id, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+func (config *SignatureConfig) reject(code int, reason, message string, err error) error {
+	config.Stats.Incr("webhook_signature_rejected", stats.Labels{"reason", reason}, 1)
+
+	return newAuthHTTPError(code, reason, message, err)
+}
+
+// NewMemoryNonceCache returns a NonceCache that keeps nonces in memory.
+// Nonces are not shared between replicas.
+func NewMemoryNonceCache() NonceCache {
+	return &memoryNonceCache{
+		nonces: make(map[string]time.Time),
+	}
+}
+
+func (m *memoryNonceCache) Add(nonce string, expiresAt time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	if now.After(m.nextPrune) {
+		for n, exp := range m.nonces {
+			if exp.Before(now) {
+				delete(m.nonces, n)
+			}
+		}
+
+		m.nextPrune = now.Add(time.Minute)
+	}
+
+	if exp, ok := m.nonces[nonce]; ok && !exp.Before(now) {
+		return false, nil
+	}
+
+	m.nonces[nonce] = expiresAt
+
+	return true, nil
+}
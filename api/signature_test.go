@@ -0,0 +1,153 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/zjeremiah/stdlib/stats"
+	"github.com/zjeremiah/stdlib/xhttp"
+)
+
+type countingStats struct {
+	stats.NoOpClient
+
+	counts map[string]int64
+}
+
+func (s *countingStats) Incr(key string, labels stats.Labels, value int64) error {
+	s.counts[key+labelString(labels)] += value
+	return nil
+}
+
+func labelString(labels stats.Labels) string {
+	var b strings.Builder
+
+	for i := 0; i+1 < len(labels); i += 2 {
+		b.WriteString("{" + labels[i] + "=" + labels[i+1] + "}")
+	}
+
+	return b.String()
+}
+
+func TestVerifySignature(t *testing.T) {
+	oldKey := xhttp.SigningKey{ID: "old", Secret: []byte("old secret")}
+	newKey := xhttp.SigningKey{ID: "new", Secret: []byte("new secret")}
+	unknownKey := xhttp.SigningKey{ID: "unknown", Secret: []byte("unknown secret")}
+
+	counts := &countingStats{counts: make(map[string]int64)}
+
+	handler := VerifySignature(SignatureConfig{
+		Keys:  []xhttp.SigningKey{oldKey, newKey},
+		Stats: counts,
+	})(func(c echo.Context) error {
+		return c.String(http.StatusOK, c.Get(SignatureKeyIDContextKey).(string))
+	})
+
+	e := echo.New()
+
+	signed := func(body string, at time.Time, keys ...xhttp.SigningKey) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/hook?id=1", strings.NewReader(body))
+		if err := xhttp.SignRequest(req, at, keys...); err != nil {
+			t.Fatal(err)
+		}
+
+		return req
+	}
+
+	serve := func(req *http.Request) (string, string) {
+		rec := httptest.NewRecorder()
+
+		err := handler(e.NewContext(req, rec))
+		if err == nil {
+			return rec.Body.String(), ""
+		}
+
+		he, ok := err.(*echo.HTTPError)
+		if !ok || he.Code != http.StatusUnauthorized {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		return "", he.Message.(*AuthError).Reason
+	}
+
+	tampered := signed("amount=1", time.Now(), oldKey)
+	tampered.Body = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("amount=9")).Body
+
+	tests := []struct {
+		name   string
+		req    *http.Request
+		keyID  string
+		reason string
+	}{
+		{"old key", signed("a", time.Now(), oldKey), "old", ""},
+		{"rotated keys", signed("a", time.Now(), unknownKey, newKey), "new", ""},
+		{"unknown key", signed("a", time.Now(), unknownKey), "", ReasonInvalidSignature},
+		{"tampered body", tampered, "", ReasonInvalidSignature},
+		{"stale", signed("a", time.Now().Add(-2*DefaultSignatureWindow), oldKey), "", ReasonStaleSignature},
+		{"unsigned", httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader("a")), "", ReasonMissingSignature},
+	}
+
+	for _, tt := range tests {
+		keyID, reason := serve(tt.req)
+		if keyID != tt.keyID || reason != tt.reason {
+			t.Errorf("%s: got key %q and reason %q, want %q and %q", tt.name, keyID, reason, tt.keyID, tt.reason)
+		}
+	}
+
+	first := signed("a", time.Now(), oldKey)
+
+	replay := httptest.NewRequest(http.MethodPost, "/hook?id=1", strings.NewReader("a"))
+	replay.Header = first.Header.Clone()
+
+	if _, reason := serve(first); reason != "" {
+		t.Fatalf("first request rejected: %s", reason)
+	}
+
+	if _, reason := serve(replay); reason != ReasonReplayedRequest {
+		t.Errorf("replay: got reason %q, want %q", reason, ReasonReplayedRequest)
+	}
+
+	if n := counts.counts["webhook_signature_rejected{reason="+ReasonInvalidSignature+"}"]; n != 2 {
+		t.Errorf("got %d invalid signatures counted, want 2", n)
+	}
+
+	for key := range counts.counts {
+		if strings.HasPrefix(key, "auth_token_rejected") {
+			t.Errorf("signature rejection counted as %s", key)
+		}
+	}
+}
+
+func TestVerifySignatureMaxBodySize(t *testing.T) {
+	key := xhttp.SigningKey{ID: "key", Secret: []byte("secret")}
+
+	handler := VerifySignature(SignatureConfig{
+		Keys:        []xhttp.SigningKey{key},
+		MaxBodySize: 8,
+	})(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	tests := []struct {
+		body string
+		code int
+	}{
+		{"12345678", http.StatusOK},
+		{"123456789", http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(tt.body))
+		if err := xhttp.SignRequest(req, time.Now(), key); err != nil {
+			t.Fatal(err)
+		}
+
+		if code := serveStatus(t, handler, req); code != tt.code {
+			t.Errorf("%d byte body: got status %d, want %d", len(tt.body), code, tt.code)
+		}
+	}
+}
@@ -75,6 +75,97 @@ func PrometheusCollectors(app, team, env string) prometheus.Collectors {
 			},
 			[]string{"path", "method"},
 		),
+		"auth_key_refresh_last_success": prom.NewGauge(
+			prom.GaugeOpts{
+				Name: "auth_key_refresh_last_success",
+				Help: "Unix time the signing keys were last refreshed",
+				ConstLabels: prom.Labels{
+					"app":  app,
+					"team": team,
+					"env":  env,
+				},
+			},
+		),
+		"auth_token_rejected": prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "auth_token_rejected",
+				Help: "The number of rejected JWTs by reason",
+				ConstLabels: prom.Labels{
+					"app":  app,
+					"team": team,
+					"env":  env,
+				},
+			},
+			[]string{"reason"},
+		),
+		"webhook_signature_rejected": prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "webhook_signature_rejected",
+				Help: "The number of rejected signed requests by reason",
+				ConstLabels: prom.Labels{
+					"app":  app,
+					"team": team,
+					"env":  env,
+				},
+			},
+			[]string{"reason"},
+		),
+		"auth_authorization_denied": prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "auth_authorization_denied",
+				Help: "The number of requests denied by role or permission checks",
+				ConstLabels: prom.Labels{
+					"app":  app,
+					"team": team,
+					"env":  env,
+				},
+			},
+			[]string{"reason", "path"},
+		),
+		"auth_key_refresh_failures": prom.NewCounter(
+			prom.CounterOpts{
+				Name: "auth_key_refresh_failures",
+				Help: "The number of failed signing key refreshes",
+				ConstLabels: prom.Labels{
+					"app":  app,
+					"team": team,
+					"env":  env,
+				},
+			},
+		),
+		"auth_key_cache_fallbacks": prom.NewCounter(
+			prom.CounterOpts{
+				Name: "auth_key_cache_fallbacks",
+				Help: "The number of times cached signing keys were used because the auth server was unreachable",
+				ConstLabels: prom.Labels{
+					"app":  app,
+					"team": team,
+					"env":  env,
+				},
+			},
+		),
+		"auth_key_cache_errors": prom.NewCounter(
+			prom.CounterOpts{
+				Name: "auth_key_cache_errors",
+				Help: "The number of failed reads and writes of the signing key cache",
+				ConstLabels: prom.Labels{
+					"app":  app,
+					"team": team,
+					"env":  env,
+				},
+			},
+		),
+		"auth_key_cache_in_use": prom.NewGauge(
+			prom.GaugeOpts{
+				Name: "auth_key_cache_in_use",
+				Help: "Whether tokens are verified with cached signing keys",
+				ConstLabels: prom.Labels{
+					"app":  app,
+					"team": team,
+					"env":  env,
+				},
+			},
+		),
 	}
 }
 
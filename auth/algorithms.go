@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// ErrAlgorithmNotAllowed is returned when a token is signed with an
+// algorithm that is not in the verifier's allowlist.
+var ErrAlgorithmNotAllowed = errors.New("token algorithm not allowed")
+
+// DefaultAlgorithm returns the algorithm tokens verified with key are
+// expected to use when no allowlist is configured: RS256 for RSA keys,
+// ES256, ES384 or ES512 for ECDSA keys depending on the curve and EdDSA
+// for Ed25519 keys.
+func DefaultAlgorithm(key interface{}) (string, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256.Alg(), nil
+	case *ecdsa.PublicKey:
+		if alg := ecdsaAlgorithm(k); alg != "" {
+			return alg, nil
+		}
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA.Alg(), nil
+	}
+
+	return "", ErrUnsupportedKey
+}
+
+// CheckAlgorithm returns an error unless a token signed with alg may be
+// verified with key. The algorithm must be in allowed, or be the key's
+// DefaultAlgorithm if allowed is empty, and it must belong to the key's
+// type, so an allowlist of several algorithms can't be used for
+// algorithm confusion (e.g. an HS256 token "signed" with an RSA public key).
+func CheckAlgorithm(key interface{}, alg string, allowed []string) error {
+	if len(allowed) == 0 {
+		def, err := DefaultAlgorithm(key)
+		if err != nil {
+			return err
+		}
+
+		allowed = []string{def}
+	}
+
+	if !containsString(allowed, alg) {
+		return fmt.Errorf("%w: %s", ErrAlgorithmNotAllowed, alg)
+	}
+
+	if !keyMatchesAlgorithm(key, alg) {
+		return ErrKeyAlgMismatch
+	}
+
+	return nil
+}
+
+// AllowedKeyfunc returns a jwt.Keyfunc that verifies tokens with the key
+// returned by key, as long as the token's algorithm passes CheckAlgorithm.
+func AllowedKeyfunc(key func() interface{}, allowed []string) jwt.Keyfunc {
+	return func(t *jwt.Token) (interface{}, error) {
+		k := key()
+
+		if err := CheckAlgorithm(k, t.Method.Alg(), allowed); err != nil {
+			return nil, err
+		}
+
+		return k, nil
+	}
+}
+
+func keyMatchesAlgorithm(key interface{}, alg string) bool {
+	method := jwt.GetSigningMethod(alg)
+	if method == nil {
+		return false
+	}
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		switch method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+			return true
+		}
+	case *ecdsa.PublicKey:
+		if _, ok := method.(*jwt.SigningMethodECDSA); ok {
+			return ecdsaAlgorithm(k) == alg
+		}
+	case ed25519.PublicKey:
+		_, ok := method.(*jwt.SigningMethodEd25519)
+		return ok
+	}
+
+	return false
+}
+
+func ecdsaAlgorithm(k *ecdsa.PublicKey) string {
+	switch k.Curve.Params().BitSize {
+	case 256:
+		return jwt.SigningMethodES256.Alg()
+	case 384:
+		return jwt.SigningMethodES384.Alg()
+	case 521:
+		return jwt.SigningMethodES512.Alg()
+	}
+
+	return ""
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func TestDefaultAlgorithm(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		key  interface{}
+		alg  string
+		err  error
+	}{
+		{"rsa", &rsaKey.PublicKey, "RS256", nil},
+		{"p-256", ecdsaPublicKey(t, elliptic.P256()), "ES256", nil},
+		{"p-384", ecdsaPublicKey(t, elliptic.P384()), "ES384", nil},
+		{"p-521", ecdsaPublicKey(t, elliptic.P521()), "ES512", nil},
+		{"ed25519", edPub, "EdDSA", nil},
+		{"hmac secret", []byte("secret"), "", ErrUnsupportedKey},
+	}
+
+	for _, tt := range tests {
+		if alg, err := DefaultAlgorithm(tt.key); alg != tt.alg || err != tt.err {
+			t.Errorf("%s: got %q, %v, want %q, %v", tt.name, alg, err, tt.alg, tt.err)
+		}
+	}
+}
+
+func TestCheckAlgorithm(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p256 := ecdsaPublicKey(t, elliptic.P256())
+
+	tests := []struct {
+		name    string
+		key     interface{}
+		alg     string
+		allowed []string
+		err     error
+	}{
+		{"default", p256, "ES256", nil, nil},
+		{"not the default", &rsaKey.PublicKey, "RS512", nil, ErrAlgorithmNotAllowed},
+		{"allowed", &rsaKey.PublicKey, "PS256", []string{"RS256", "PS256"}, nil},
+		{"not allowed", &rsaKey.PublicKey, "RS384", []string{"RS256"}, ErrAlgorithmNotAllowed},
+		{"hmac with a public key", &rsaKey.PublicKey, "HS256", []string{"RS256", "HS256"}, ErrKeyAlgMismatch},
+		{"other curve", p256, "ES384", []string{"ES256", "ES384"}, ErrKeyAlgMismatch},
+		{"other key type", p256, "EdDSA", []string{"ES256", "EdDSA"}, ErrKeyAlgMismatch},
+		{"unknown algorithm", p256, "none", []string{"none"}, ErrKeyAlgMismatch},
+	}
+
+	for _, tt := range tests {
+		if err := CheckAlgorithm(tt.key, tt.alg, tt.allowed); !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestAllowedKeyfunc(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method jwt.SigningMethod
+		signer crypto.Signer
+		key    interface{}
+	}{
+		{"ES384", jwt.SigningMethodES384, ecKey, &ecKey.PublicKey},
+		{"EdDSA", jwt.SigningMethodEdDSA, edKey, edPub},
+	}
+
+	for _, tt := range tests {
+		signed, err := jwt.NewWithClaims(tt.method, jwt.MapClaims{"username": "bob"}).SignedString(tt.signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		key := tt.key
+		if _, err := jwt.Parse(signed, AllowedKeyfunc(func() interface{} { return key }, nil)); err != nil {
+			t.Errorf("%s token rejected: %v", tt.name, err)
+		}
+	}
+}
+
+func ecdsaPublicKey(t *testing.T, curve elliptic.Curve) *ecdsa.PublicKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &key.PublicKey
+}
@@ -0,0 +1,290 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/zjeremiah/stdlib/data"
+	"github.com/zjeremiah/stdlib/stats"
+)
+
+var (
+	// ErrInvalidAPIKey is returned when an API key is malformed, unknown or revoked.
+	ErrInvalidAPIKey = errors.New("invalid api key")
+
+	// ErrAPIKeyExpired is returned when an API key is past its expiry.
+	ErrAPIKeyExpired = errors.New("api key expired")
+)
+
+// APIKeySchema creates the table used by APIKeyStore. Times are stored
+// as unix seconds, 0 meaning never. Roles and scopes are comma separated.
+const APIKeySchema = `
+CREATE TABLE IF NOT EXISTS api_keys (
+	id           VARCHAR(64) PRIMARY KEY,
+	hash         VARCHAR(64) NOT NULL,
+	user_id      VARCHAR(255) NOT NULL,
+	username     VARCHAR(255) NOT NULL,
+	roles        TEXT NOT NULL,
+	scopes       TEXT NOT NULL,
+	created_at   BIGINT NOT NULL,
+	expires_at   BIGINT NOT NULL,
+	last_used_at BIGINT NOT NULL,
+	revoked_at   BIGINT NOT NULL
+);`
+
+const apiKeyColumns = `id, hash, user_id, username, roles, scopes, created_at, expires_at, last_used_at, revoked_at`
+
+// apiKeyLastUsedResolution is how stale last_used_at may get before an
+// authentication writes it again, so busy keys don't cause a write per request.
+const apiKeyLastUsedResolution = time.Minute
+
+type (
+	// APIKey is a stored API key. The secret part of the key is only
+	// ever stored as a SHA-256 hash.
+	APIKey struct {
+		ID         string `db:"id"`
+		Hash       string `db:"hash"`
+		UserID     string `db:"user_id"`
+		Username   string `db:"username"`
+		Roles      string `db:"roles"`
+		Scopes     string `db:"scopes"`
+		CreatedAt  int64  `db:"created_at"`
+		ExpiresAt  int64  `db:"expires_at"`
+		LastUsedAt int64  `db:"last_used_at"`
+		RevokedAt  int64  `db:"revoked_at"`
+	}
+
+	// APIKeyStore creates, rotates and authenticates API keys stored
+	// in the table from APIKeySchema.
+	APIKeyStore struct {
+		db    data.SqlxWrapper
+		stats stats.Client
+	}
+)
+
+// NewAPIKeyStore returns an APIKeyStore using the given database.
+func NewAPIKeyStore(db data.SqlxWrapper) *APIKeyStore {
+	return NewAPIKeyStoreWithStats(db, nil)
+}
+
+// NewAPIKeyStoreWithStats returns an APIKeyStore using the given database
+// and counting failed last_used_at writes. The stats client may be nil.
+func NewAPIKeyStoreWithStats(db data.SqlxWrapper, statsClient stats.Client) *APIKeyStore {
+	if statsClient == nil {
+		statsClient = new(stats.NoOpClient)
+	}
+
+	return &APIKeyStore{db: db, stats: statsClient}
+}
+
+// Create stores a new API key and returns it in plain text. This is the
+// only time the plain text key is available. A ttl of 0 never expires.
+func (s *APIKeyStore) Create(userID, username string, roles, scopes []string, ttl time.Duration) (string, *APIKey, error) {
+	key := &APIKey{
+		UserID:   userID,
+		Username: username,
+		Roles:    strings.Join(roles, ","),
+		Scopes:   strings.Join(scopes, ","),
+	}
+
+	plain, err := s.insert(s.db, key, ttl)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return plain, key, nil
+}
+
+// Rotate replaces the API key with the given id by a new key with the same
+// user, roles and scopes. The old key keeps working for the grace period
+// so clients can switch over. A ttl of 0 never expires.
+func (s *APIKeyStore) Rotate(id string, grace, ttl time.Duration) (string, *APIKey, error) {
+	var (
+		plain string
+		key   *APIKey
+	)
+
+	err := data.WithTransaction(s.db, func(tx data.TxWrapper) error {
+		old := new(APIKey)
+		if err := tx.Get(old, tx.Rebind(`SELECT `+apiKeyColumns+` FROM api_keys WHERE id = ? AND revoked_at = 0`), id); err == sql.ErrNoRows {
+			return ErrInvalidAPIKey
+		} else if err != nil {
+			return err
+		}
+
+		expires := time.Now().Add(grace).Unix()
+		if old.ExpiresAt == 0 || expires < old.ExpiresAt {
+			if _, err := tx.Exec(tx.Rebind(`UPDATE api_keys SET expires_at = ? WHERE id = ?`), expires, id); err != nil {
+				return err
+			}
+		}
+
+		key = &APIKey{
+			UserID:   old.UserID,
+			Username: old.Username,
+			Roles:    old.Roles,
+			Scopes:   old.Scopes,
+		}
+
+		var err error
+		plain, err = s.insert(tx, key, ttl)
+
+		return err
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return plain, key, nil
+}
+
+// Revoke makes the API key with the given id unusable.
+func (s *APIKeyStore) Revoke(id string) error {
+	_, err := s.db.Exec(s.db.Rebind(`UPDATE api_keys SET revoked_at = ? WHERE id = ?`), time.Now().Unix(), id)
+	return err
+}
+
+// Authenticate returns the stored key matching the plain text key and
+// records that it was used. Failing to record the use is counted with
+// auth_api_key_last_used_errors rather than failing the authentication.
+func (s *APIKeyStore) Authenticate(plain string) (*APIKey, error) {
+	id, secret, ok := splitSecretToken(plain)
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+
+	key := new(APIKey)
+	if err := s.db.Get(key, s.db.Rebind(`SELECT `+apiKeyColumns+` FROM api_keys WHERE id = ?`), id); err == sql.ErrNoRows {
+		return nil, ErrInvalidAPIKey
+	} else if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(key.Hash)) != 1 || key.RevokedAt != 0 {
+		return nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+
+	if key.ExpiresAt != 0 && now.Unix() >= key.ExpiresAt {
+		return nil, ErrAPIKeyExpired
+	}
+
+	if now.Unix()-key.LastUsedAt >= int64(apiKeyLastUsedResolution/time.Second) {
+		if _, err := s.db.Exec(s.db.Rebind(`UPDATE api_keys SET last_used_at = ? WHERE id = ?`), now.Unix(), id); err != nil {
+			s.stats.Incr("auth_api_key_last_used_errors", stats.EmptyLabels(), 1)
+		} else {
+			key.LastUsedAt = now.Unix()
+		}
+	}
+
+	return key, nil
+}
+
+// RoleList returns the key's roles.
+func (k *APIKey) RoleList() []string {
+	return splitList(k.Roles)
+}
+
+// ScopeList returns the key's scopes.
+func (k *APIKey) ScopeList() []string {
+	return splitList(k.Scopes)
+}
+
+// HasScope reports whether the key carries the scope.
+func (k *APIKey) HasScope(scope string) bool {
+	return containsString(k.ScopeList(), scope)
+}
+
+// Principal returns the principal the key authenticates. Its claims have
+// the same shape as those decoded from a JWT, plus "scopes" and "api_key_id".
+func (k *APIKey) Principal() *Principal {
+	return NewPrincipal(map[string]interface{}{
+		"id":         k.UserID,
+		"username":   k.Username,
+		"roles":      toInterfaces(k.RoleList()),
+		"scopes":     toInterfaces(k.ScopeList()),
+		"api_key_id": k.ID,
+	})
+}
+
+func (s *APIKeyStore) insert(db data.DataContext, key *APIKey, ttl time.Duration) (string, error) {
+	id, err := randomString(8, hex.EncodeToString)
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := randomString(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	key.ID = id
+	key.Hash = hashSecret(secret)
+	key.CreatedAt = now.Unix()
+
+	if ttl > 0 {
+		key.ExpiresAt = now.Add(ttl).Unix()
+	}
+
+	_, err = db.NamedExec(`INSERT INTO api_keys (`+apiKeyColumns+`)
+		VALUES (:id, :hash, :user_id, :username, :roles, :scopes, :created_at, :expires_at, :last_used_at, :revoked_at)`, key)
+	if err != nil {
+		return "", err
+	}
+
+	return id + "." + secret, nil
+}
+
+func splitSecretToken(plain string) (string, string, bool) {
+	i := strings.IndexByte(plain, '.')
+	if i <= 0 || i == len(plain)-1 {
+		return "", "", false
+	}
+
+	return plain[:i], plain[i+1:], true
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int, encode func([]byte) string) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return encode(b), nil
+}
+
+func splitList(s string) []string {
+	var list []string
+
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+func toInterfaces(list []string) []interface{} {
+	out := make([]interface{}, len(list))
+	for i, s := range list {
+		out[i] = s
+	}
+
+	return out
+}
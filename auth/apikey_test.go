@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIKeyStoreAuthenticate(t *testing.T) {
+	store := NewAPIKeyStore(newTestDB(t, APIKeySchema))
+
+	plain, created, err := store.Create("7", "bob", []string{"admin"}, []string{"read", "write"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := store.Authenticate(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if key.ID != created.ID || key.LastUsedAt == 0 || !key.HasScope("write") || key.HasScope("delete") {
+		t.Errorf("got key %+v", key)
+	}
+
+	p := key.Principal()
+	if p.ID != "7" || p.Username != "bob" || !reflect.DeepEqual(p.Roles, []string{"admin"}) {
+		t.Errorf("got principal %+v", p)
+	}
+
+	if id, _ := p.Claim("api_key_id"); id != created.ID {
+		t.Errorf("got api_key_id %v, want %s", id, created.ID)
+	}
+
+	id := plain[:strings.IndexByte(plain, '.')]
+
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{"wrong secret", id + ".wrong"},
+		{"unknown id", "unknown." + plain[len(id)+1:]},
+		{"no separator", id},
+		{"empty secret", id + "."},
+		{"empty", ""},
+	}
+
+	for _, tt := range tests {
+		if _, err := store.Authenticate(tt.key); err != ErrInvalidAPIKey {
+			t.Errorf("%s: got %v, want %v", tt.name, err, ErrInvalidAPIKey)
+		}
+	}
+
+	if err := store.Revoke(created.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Authenticate(plain); err != ErrInvalidAPIKey {
+		t.Errorf("revoked key: got %v, want %v", err, ErrInvalidAPIKey)
+	}
+}
+
+func TestAPIKeyStoreRotate(t *testing.T) {
+	store := NewAPIKeyStore(newTestDB(t, APIKeySchema))
+
+	oldPlain, old, err := store.Create("7", "bob", []string{"admin"}, []string{"read"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newPlain, key, err := store.Rotate(old.ID, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if key.ID == old.ID || key.UserID != "7" || key.Scopes != "read" {
+		t.Errorf("got rotated key %+v", key)
+	}
+
+	for name, plain := range map[string]string{"old key in grace period": oldPlain, "new key": newPlain} {
+		if _, err := store.Authenticate(plain); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	// Rotating without a grace period expires the old key right away.
+	if _, _, err := store.Rotate(key.ID, -time.Second, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Authenticate(newPlain); err != ErrAPIKeyExpired {
+		t.Errorf("rotated key: got %v, want %v", err, ErrAPIKeyExpired)
+	}
+
+	if err := store.Revoke(old.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{old.ID, "unknown"} {
+		if _, _, err := store.Rotate(id, time.Hour, 0); err != ErrInvalidAPIKey {
+			t.Errorf("rotate %s: got %v, want %v", id, err, ErrInvalidAPIKey)
+		}
+	}
+}
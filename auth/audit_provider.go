@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"errors"
+	"time"
+)
+
+type (
+	// IPLoginProvider is a Provider that can take the client's IP into
+	// account, like ThrottledProvider and AuditedProvider.
+	IPLoginProvider interface {
+		Provider
+		LoginFrom(ip, username, password string) (Token, error)
+	}
+
+	// AuditedProvider is a Provider that records an audit event for
+	// every login. Logins answered with an MFA challenge are recorded as
+	// EventMFARequired, as the password was right.
+	AuditedProvider struct {
+		provider Provider
+		audit    *Auditor
+	}
+
+	auditedRevocationStore struct {
+		RevocationStore
+		audit *Auditor
+	}
+)
+
+// NewAuditedProvider wraps provider to record logins with the auditor.
+func NewAuditedProvider(provider Provider, audit *Auditor) *AuditedProvider {
+	return &AuditedProvider{
+		provider: provider,
+		audit:    audit,
+	}
+}
+
+// Login is LoginFrom without a client IP.
+func (a *AuditedProvider) Login(username, password string) (Token, error) {
+	return a.LoginFrom("", username, password)
+}
+
+// LoginFrom logs in with the wrapped provider and records the outcome.
+func (a *AuditedProvider) LoginFrom(ip, username, password string) (Token, error) {
+	token, err := loginFrom(a.provider, ip, username, password)
+
+	e := AuditEvent{
+		Type:     EventLoginSuccess,
+		Username: username,
+		ClientIP: ip,
+	}
+
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrMFARequired):
+		e.Type = EventMFARequired
+	case errors.Is(err, ErrInvalidLogin):
+		e.Type, e.Reason = EventLoginFailure, ReasonInvalidLogin
+	case errors.Is(err, ErrLockedOut):
+		e.Type, e.Reason = EventLoginFailure, ReasonLockedOut
+	default:
+		e.Type, e.Reason, e.Error = EventLoginFailure, ReasonError, err.Error()
+	}
+
+	a.audit.Record(e)
+
+	return token, err
+}
+
+// RequestSigningKeys is passed on to the wrapped provider.
+func (a *AuditedProvider) RequestSigningKeys(name, token string) (*SigningKeys, error) {
+	return a.provider.RequestSigningKeys(name, token)
+}
+
+// NewAuditedRevocationStore wraps store to record revocations with the auditor.
+func NewAuditedRevocationStore(store RevocationStore, audit *Auditor) RevocationStore {
+	return &auditedRevocationStore{
+		RevocationStore: store,
+		audit:           audit,
+	}
+}
+
+func (s *auditedRevocationStore) RevokeToken(jti string, expiresAt time.Time) error {
+	if err := s.RevocationStore.RevokeToken(jti, expiresAt); err != nil {
+		return err
+	}
+
+	s.audit.Record(AuditEvent{Type: EventTokenRevoked, TokenID: jti})
+
+	return nil
+}
+
+func (s *auditedRevocationStore) RevokeUser(userID string, before time.Time) error {
+	if err := s.RevocationStore.RevokeUser(userID, before); err != nil {
+		return err
+	}
+
+	s.audit.Record(AuditEvent{Type: EventUserRevoked, UserID: userID})
+
+	return nil
+}
+
+// loginFrom passes the client IP on to providers that take it.
+func loginFrom(provider Provider, ip, username, password string) (Token, error) {
+	if p, ok := provider.(IPLoginProvider); ok {
+		return p.LoginFrom(ip, username, password)
+	}
+
+	return provider.Login(username, password)
+}
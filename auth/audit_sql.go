@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"github.com/zjeremiah/stdlib/data"
+)
+
+// AuditSchema creates the table used by the SQL AuditSink. Times are
+// stored as unix milliseconds.
+const AuditSchema = `
+CREATE TABLE IF NOT EXISTS auth_audit_events (
+	occurred_at BIGINT NOT NULL,
+	event_type  VARCHAR(64) NOT NULL,
+	reason      VARCHAR(64) NOT NULL,
+	username    VARCHAR(255) NOT NULL,
+	user_id     VARCHAR(255) NOT NULL,
+	token_id    VARCHAR(255) NOT NULL,
+	client_ip   VARCHAR(64) NOT NULL,
+	path        VARCHAR(1024) NOT NULL,
+	error       TEXT NOT NULL
+);`
+
+type sqlAuditSink struct {
+	db data.SqlxWrapper
+}
+
+// NewSQLAuditSink returns an AuditSink inserting events into the table in AuditSchema.
+func NewSQLAuditSink(db data.SqlxWrapper) AuditSink {
+	return &sqlAuditSink{db: db}
+}
+
+func (s *sqlAuditSink) Record(e *AuditEvent) error {
+	_, err := s.db.Exec(s.db.Rebind(`INSERT INTO auth_audit_events
+		(occurred_at, event_type, reason, username, user_id, token_id, client_ip, path, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		e.Time.UnixMilli(), e.Type, e.Reason, e.Username, e.UserID, e.TokenID, e.ClientIP, e.Path, e.Error)
+
+	return err
+}
@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+type recordingSink struct {
+	events []AuditEvent
+}
+
+func (s *recordingSink) Record(e *AuditEvent) error {
+	s.events = append(s.events, *e)
+	return nil
+}
+
+// stubProvider returns err from every login, or a token if it is nil.
+type stubProvider struct {
+	err error
+}
+
+func (p *stubProvider) Login(username, password string) (Token, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	return Token("token"), nil
+}
+
+func (p *stubProvider) RequestSigningKeys(name, token string) (*SigningKeys, error) {
+	return nil, ErrSigningKeysUnsupported
+}
+
+func TestAuditedProvider(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		typ    string
+		reason string
+	}{
+		{"success", nil, EventLoginSuccess, ""},
+		{"invalid login", ErrInvalidLogin, EventLoginFailure, ReasonInvalidLogin},
+		{"locked out", &LockedOutError{Until: time.Now()}, EventLoginFailure, ReasonLockedOut},
+		{"mfa challenge", &MFAChallengeError{Challenge: "c"}, EventMFARequired, ""},
+		{"error", errors.New("database down"), EventLoginFailure, ReasonError},
+	}
+
+	for _, tt := range tests {
+		sink := new(recordingSink)
+		provider := NewAuditedProvider(&stubProvider{err: tt.err}, NewAuditor(sink, nil))
+
+		if _, err := provider.LoginFrom("10.0.0.1", "bob", "password"); err != tt.err {
+			t.Errorf("%s: got %v, want the provider's error passed on", tt.name, err)
+		}
+
+		if len(sink.events) != 1 {
+			t.Fatalf("%s: got %d events, want 1", tt.name, len(sink.events))
+		}
+
+		e := sink.events[0]
+		if e.Type != tt.typ || e.Reason != tt.reason || e.Username != "bob" || e.ClientIP != "10.0.0.1" || e.Time.IsZero() {
+			t.Errorf("%s: got event %+v, want type %q and reason %q", tt.name, e, tt.typ, tt.reason)
+		}
+	}
+}
+
+func TestAuditedRevocationStore(t *testing.T) {
+	sink := new(recordingSink)
+	store := NewAuditedRevocationStore(NewMemoryRevocationStore(), NewAuditor(sink, nil))
+
+	if err := store.RevokeToken("jti-1", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.RevokeUser("user-1", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []AuditEvent{
+		{Type: EventTokenRevoked, TokenID: "jti-1"},
+		{Type: EventUserRevoked, UserID: "user-1"},
+	}
+
+	if len(sink.events) != len(want) {
+		t.Fatalf("got %d events, want %d", len(sink.events), len(want))
+	}
+
+	for i, e := range sink.events {
+		e.Time = time.Time{}
+		if e != want[i] {
+			t.Errorf("got event %+v, want %+v", e, want[i])
+		}
+	}
+}
+
+func TestJSONLinesSink(t *testing.T) {
+	var buf bytes.Buffer
+
+	var nilAuditor *Auditor
+	nilAuditor.Record(AuditEvent{Type: EventLoginSuccess})
+
+	NewAuditor(NewJSONLinesSink(&buf), nil).Record(AuditEvent{Type: EventLoginFailure, Reason: ReasonInvalidLogin, Username: "bob"})
+
+	var e map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &e); err != nil {
+		t.Fatal(err)
+	}
+
+	if e["type"] != EventLoginFailure || e["reason"] != ReasonInvalidLogin || e["username"] != "bob" || e["time"] == nil {
+		t.Errorf("got %v, want the event as JSON", e)
+	}
+
+	if _, ok := e["token_id"]; ok {
+		t.Errorf("got empty field token_id in %v", e)
+	}
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// TokenExchangeGrantType is the OAuth2 grant type of RFC 8693 token exchange.
+const TokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+// ErrTokenExchangeDenied is returned when the auth server refuses to
+// exchange a token.
+var ErrTokenExchangeDenied = errors.New("token exchange denied")
+
+type (
+	// TokenExchanger swaps a token for another one for the same subject,
+	// restricted to the given audience and scopes.
+	TokenExchanger interface {
+		ExchangeToken(subject Token, audience string, scopes []string) (Token, error)
+	}
+
+	exchangeBody struct {
+		SubjectToken string   `json:"subject_token"`
+		Audience     string   `json:"audience,omitempty"`
+		Scopes       []string `json:"scopes,omitempty"`
+	}
+)
+
+// ExchangeToken asks the RM Auth service for a token for the subject
+// of the given token, restricted to the audience and scopes.
+func (a *providerImpl) ExchangeToken(subject Token, audience string, scopes []string) (Token, error) {
+	b, err := json.Marshal(&exchangeBody{
+		SubjectToken: subject.String(),
+		Audience:     audience,
+		Scopes:       scopes,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", a.makeURL("v1/token/exchange"), bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	b, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, ErrTokenExchangeDenied
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token exchange failed: %s", resp.Status)
+	}
+
+	respBody := new(loginResp)
+	if err := json.Unmarshal(b, respBody); err != nil {
+		return nil, err
+	}
+
+	return []byte(respBody.Token), nil
+}
+
+// ExchangeToken runs the RFC 8693 token exchange grant against the
+// issuer's token endpoint and returns the issued access token.
+func (o *OIDCProvider) ExchangeToken(subject Token, audience string, scopes []string) (Token, error) {
+	form := url.Values{}
+	form.Set("grant_type", TokenExchangeGrantType)
+	form.Set("subject_token", subject.String())
+	form.Set("subject_token_type", "urn:ietf:params:oauth:token-type:jwt")
+
+	if audience != "" {
+		form.Set("audience", audience)
+	}
+
+	if len(scopes) > 0 {
+		form.Set("scope", strings.Join(scopes, " "))
+	}
+
+	req, err := http.NewRequest("POST", o.discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(o.clientID), url.QueryEscape(o.clientSecret))
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized {
+		return nil, ErrTokenExchangeDenied
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc token exchange failed: %s", resp.Status)
+	}
+
+	tokenResp := new(oidcTokenResp)
+	if err := json.Unmarshal(b, tokenResp); err != nil {
+		return nil, err
+	}
+
+	if tokenResp.AccessToken == "" {
+		return nil, errors.New("oidc token exchange response has no token")
+	}
+
+	return []byte(tokenResp.AccessToken), nil
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// FakeJWKSPath is the path the FakeJWKSServer serves its key set on.
+const FakeJWKSPath = "/.well-known/jwks.json"
+
+// FakeJWKSServer is an httptest backed stand-in for an auth server's
+// JWKS endpoint. It is meant to be used in tests.
+type FakeJWKSServer struct {
+	*httptest.Server
+
+	mu       sync.RWMutex
+	keys     map[string]*rsa.PrivateKey
+	requests int
+}
+
+// NewFakeJWKSServer starts a FakeJWKSServer with no keys.
+// Callers must call Close when done.
+func NewFakeJWKSServer() *FakeJWKSServer {
+	f := &FakeJWKSServer{
+		keys: make(map[string]*rsa.PrivateKey),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(FakeJWKSPath, f.serveJWKS)
+
+	f.Server = httptest.NewServer(mux)
+
+	return f
+}
+
+// JWKSURL returns the full url of the key set.
+func (f *FakeJWKSServer) JWKSURL() string {
+	return f.URL + FakeJWKSPath
+}
+
+// AddKey generates a new RSA key with the given key id and publishes it.
+func (f *FakeJWKSServer) AddKey(kid string) (*rsa.PrivateKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	f.keys[kid] = key
+	f.mu.Unlock()
+
+	return key, nil
+}
+
+// RemoveKey stops publishing the key with the given key id.
+func (f *FakeJWKSServer) RemoveKey(kid string) {
+	f.mu.Lock()
+	delete(f.keys, kid)
+	f.mu.Unlock()
+}
+
+// Sign returns an RS256 token signed with the key with the given key id.
+func (f *FakeJWKSServer) Sign(kid string, claims jwt.MapClaims) (Token, error) {
+	f.mu.RLock()
+	key, ok := f.keys[kid]
+	f.mu.RUnlock()
+
+	if !ok {
+		return nil, errors.New("fake jwks: no such key")
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+
+	signedToken, err := token.SignedString(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(signedToken), nil
+}
+
+// Requests returns how many times the key set has been fetched.
+func (f *FakeJWKSServer) Requests() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.requests
+}
+
+func (f *FakeJWKSServer) serveJWKS(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests++
+
+	set := JWKS{Keys: make([]JWK, 0, len(f.keys))}
+	for kid, key := range f.keys {
+		set.Keys = append(set.Keys, NewRSAJWK(kid, &key.PublicKey))
+	}
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(set)
+}
@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// FakeOIDCKeyID is the key id of the key a FakeOIDCIssuer signs with.
+const FakeOIDCKeyID = "fake-oidc"
+
+type (
+	// FakeOIDCIssuer is an httptest backed stand-in for an OpenID Connect
+	// issuer. It serves discovery, a JWKS and a token endpoint supporting
+	// the password, client credentials and token exchange grants. It is
+	// meant to be used in tests.
+	FakeOIDCIssuer struct {
+		*httptest.Server
+
+		// PrivateKey signs every token the issuer mints.
+		PrivateKey *rsa.PrivateKey
+
+		// TokenTTL is the lifetime of minted tokens.
+		TokenTTL time.Duration
+
+		mu      sync.RWMutex
+		clients map[string]string
+		users   map[string]fakeUser
+	}
+)
+
+// NewFakeOIDCIssuer starts a FakeOIDCIssuer with a new RSA key and no
+// clients or users. Callers must call Close when done.
+func NewFakeOIDCIssuer() (*FakeOIDCIssuer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &FakeOIDCIssuer{
+		PrivateKey: key,
+		TokenTTL:   DefaultFakeTokenTTL,
+		clients:    make(map[string]string),
+		users:      make(map[string]fakeUser),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(OIDCDiscoveryPath, f.serveDiscovery)
+	mux.HandleFunc("/jwks", f.serveJWKS)
+	mux.HandleFunc("/token", f.serveToken)
+
+	f.Server = httptest.NewServer(mux)
+
+	return f, nil
+}
+
+// Issuer returns the issuer identifier, which is the server's url.
+func (f *FakeOIDCIssuer) Issuer() string {
+	return f.URL
+}
+
+// AddClient registers an OAuth2 client.
+func (f *FakeOIDCIssuer) AddClient(id, secret string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.clients[id] = secret
+}
+
+// AddUser lets the user log in with the password grant. Tokens carry
+// "sub" and "preferred_username" set to username, plus claims.
+func (f *FakeOIDCIssuer) AddUser(username, password string, claims map[string]interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	userClaims := map[string]interface{}{
+		"sub":                username,
+		"preferred_username": username,
+	}
+
+	for k, v := range claims {
+		userClaims[k] = v
+	}
+
+	f.users[username] = fakeUser{password: password, claims: userClaims}
+}
+
+// Mint returns a token for the audience signed by the issuer. "iss",
+// "aud", "iat" and "exp" are set unless present in claims.
+func (f *FakeOIDCIssuer) Mint(audience string, claims map[string]interface{}) (Token, error) {
+	now := time.Now()
+
+	mapClaims := jwt.MapClaims{
+		"iss": f.Issuer(),
+		"aud": audience,
+		"iat": now.Unix(),
+		"exp": now.Add(f.TokenTTL).Unix(),
+	}
+
+	for k, v := range claims {
+		mapClaims[k] = v
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, mapClaims)
+	token.Header["kid"] = FakeOIDCKeyID
+
+	signedToken, err := token.SignedString(f.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(signedToken), nil
+}
+
+func (f *FakeOIDCIssuer) serveDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeFakeJSON(w, &OIDCDiscovery{
+		Issuer:              f.Issuer(),
+		TokenEndpoint:       f.URL + "/token",
+		JWKSURI:             f.URL + "/jwks",
+		GrantTypesSupported: []string{"password", "client_credentials", TokenExchangeGrantType},
+		IDTokenSigningAlgs:  []string{jwt.SigningMethodRS256.Alg()},
+	})
+}
+
+func (f *FakeOIDCIssuer) serveJWKS(w http.ResponseWriter, r *http.Request) {
+	writeFakeJSON(w, &JWKS{Keys: []JWK{NewRSAJWK(FakeOIDCKeyID, &f.PrivateKey.PublicKey)}})
+}
+
+func (f *FakeOIDCIssuer) serveToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	clientID, secret, ok := r.BasicAuth()
+
+	f.mu.RLock()
+	want, known := f.clients[clientID]
+	user, userOK := f.users[r.PostForm.Get("username")]
+	f.mu.RUnlock()
+
+	if !ok || !known || want != secret {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+
+	var claims map[string]interface{}
+
+	switch r.PostForm.Get("grant_type") {
+	case "client_credentials":
+		claims = map[string]interface{}{"sub": clientID}
+	case "password":
+		if !userOK || user.password != r.PostForm.Get("password") {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant")
+			return
+		}
+
+		claims = user.claims
+	case TokenExchangeGrantType:
+		exchanged, err := fakeExchangeClaims(r.PostForm.Get("subject_token"), &f.PrivateKey.PublicKey,
+			r.PostForm.Get("audience"), strings.Fields(r.PostForm.Get("scope")))
+		if err != nil {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant")
+			return
+		}
+
+		claims = exchanged
+	default:
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	accessToken, err := f.Mint(clientID, claims)
+	if err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	resp := &oidcTokenResp{
+		AccessToken: accessToken.String(),
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(f.TokenTTL / time.Second),
+	}
+
+	if r.PostForm.Get("grant_type") == "password" && hasScope(r.PostForm.Get("scope"), "openid") {
+		resp.IDToken = resp.AccessToken
+	}
+
+	writeFakeJSON(w, resp)
+}
+
+func writeOAuthError(w http.ResponseWriter, code int, oauthErr string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write([]byte(`{"error":"` + oauthErr + `"}`))
+}
+
+func hasScope(scopes, scope string) bool {
+	return containsString(strings.Fields(scopes), scope)
+}
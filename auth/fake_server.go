@@ -0,0 +1,288 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// DefaultFakeTokenTTL is the lifetime of tokens minted by a FakeAuthServer.
+const DefaultFakeTokenTTL = time.Hour
+
+type (
+	// FakeAuthServer is an httptest backed stand-in for the RM Auth
+	// service. It serves POST /v1/login, POST /v1/auth and POST
+	// /v1/token/exchange with the same request and response shapes,
+	// signing RS256 tokens with a freshly generated key. It is meant to
+	// be used in tests, e.g. to run api.SetupAuth end to end without
+	// Devmode.
+	FakeAuthServer struct {
+		*httptest.Server
+
+		// PrivateKey signs every token the server mints.
+		PrivateKey *rsa.PrivateKey
+
+		// TokenTTL is the lifetime of minted tokens.
+		TokenTTL time.Duration
+
+		mu       sync.RWMutex
+		users    map[string]fakeUser
+		services map[string]string
+		nextID   int
+	}
+
+	fakeUser struct {
+		password string
+		claims   map[string]interface{}
+	}
+
+	authBody struct {
+		ServiceName  string `json:"service_name"`
+		ServiceToken string `json:"service_token"`
+	}
+)
+
+// NewFakeAuthServer starts a FakeAuthServer with a new RSA key and no
+// users. Until a service is added with AddService, any service name and
+// token are handed the signing keys. Callers must call Close when done.
+func NewFakeAuthServer() (*FakeAuthServer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &FakeAuthServer{
+		PrivateKey: key,
+		TokenTTL:   DefaultFakeTokenTTL,
+		users:      make(map[string]fakeUser),
+		services:   make(map[string]string),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/login", f.serveLogin)
+	mux.HandleFunc("/v1/auth", f.serveAuth)
+	mux.HandleFunc("/v1/token/exchange", f.serveExchange)
+
+	f.Server = httptest.NewServer(mux)
+
+	return f, nil
+}
+
+// AddUser lets the user log in with the given email and password. The
+// minted tokens carry "username" (the email), "roles" (empty) and a
+// numeric "id", overridden and extended by claims.
+func (f *FakeAuthServer) AddUser(email, password string, claims map[string]interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.nextID++
+
+	userClaims := map[string]interface{}{
+		"username": email,
+		"roles":    []string{},
+		"id":       f.nextID,
+	}
+
+	for k, v := range claims {
+		userClaims[k] = v
+	}
+
+	f.users[email] = fakeUser{password: password, claims: userClaims}
+}
+
+// AddService only hands the signing keys to services with a registered token.
+func (f *FakeAuthServer) AddService(name, token string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.services[name] = token
+}
+
+// Mint returns a token signed by the server with the given claims.
+// "exp" and "iat" are added unless present.
+func (f *FakeAuthServer) Mint(claims map[string]interface{}) (Token, error) {
+	now := time.Now()
+
+	mapClaims := jwt.MapClaims{
+		"iat": now.Unix(),
+		"exp": now.Add(f.TokenTTL).Unix(),
+	}
+
+	for k, v := range claims {
+		mapClaims[k] = v
+	}
+
+	signedToken, err := jwt.NewWithClaims(jwt.SigningMethodRS256, mapClaims).SignedString(f.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(signedToken), nil
+}
+
+// SigningKeys returns the keys the server hands out on /v1/auth:
+// base64 encoded PEM, like the RM Auth service.
+func (f *FakeAuthServer) SigningKeys() (*SigningKeys, error) {
+	pub, err := x509.MarshalPKIXPublicKey(&f.PrivateKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	priv := x509.MarshalPKCS1PrivateKey(f.PrivateKey)
+
+	return &SigningKeys{
+		PublicKey:  base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})),
+		PrivateKey: base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: priv})),
+	}, nil
+}
+
+func (f *FakeAuthServer) serveLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	login := new(loginBody)
+	if err := json.NewDecoder(r.Body).Decode(login); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	f.mu.RLock()
+	user, ok := f.users[login.Email]
+	f.mu.RUnlock()
+
+	if !ok || user.password != login.Password {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	token, err := f.Mint(user.claims)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeFakeJSON(w, &loginResp{Token: token.String()})
+}
+
+func (f *FakeAuthServer) serveAuth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body := new(authBody)
+	if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := f.checkService(body); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	keys, err := f.SigningKeys()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeFakeJSON(w, keys)
+}
+
+func (f *FakeAuthServer) serveExchange(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body := new(exchangeBody)
+	if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	claims, err := fakeExchangeClaims(body.SubjectToken, &f.PrivateKey.PublicKey, body.Audience, body.Scopes)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	token, err := f.Mint(claims)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeFakeJSON(w, &loginResp{Token: token.String()})
+}
+
+func (f *FakeAuthServer) checkService(body *authBody) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if len(f.services) == 0 {
+		return nil
+	}
+
+	if token, ok := f.services[body.ServiceName]; !ok || token != body.ServiceToken {
+		return errors.New("unknown service")
+	}
+
+	return nil
+}
+
+// fakeExchangeClaims verifies the subject token and returns its claims
+// narrowed to the audience and scopes. Scopes must be a subset of the
+// subject token's "scopes" claim, if it has one. The new token expires
+// no later than the subject token.
+func fakeExchangeClaims(subject string, key *rsa.PublicKey, audience string, scopes []string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(subject, AllowedKeyfunc(func() interface{} { return key }, nil))
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+	for k, v := range token.Claims.(jwt.MapClaims) {
+		claims[k] = v
+	}
+
+	if granted, ok := claims["scopes"]; ok {
+		have := claimStrings(granted)
+
+		for _, scope := range scopes {
+			if !containsString(have, scope) {
+				return nil, errors.New("scope not granted")
+			}
+		}
+	}
+
+	delete(claims, "iat")
+
+	if audience != "" {
+		claims["aud"] = audience
+	}
+
+	if len(scopes) > 0 {
+		claims["scopes"] = scopes
+	}
+
+	return claims, nil
+}
+
+func writeFakeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
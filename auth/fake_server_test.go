@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func TestFakeAuthServer(t *testing.T) {
+	f, err := NewFakeAuthServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	f.AddUser("bob@example.com", "secret", map[string]interface{}{"roles": []string{"admin"}, "tenant": "acme"})
+	f.AddService("app", "app-token")
+
+	provider := NewProvider(f.URL)
+
+	if _, err := provider.Login("bob@example.com", "wrong"); err != ErrInvalidLogin {
+		t.Errorf("wrong password: got %v, want %v", err, ErrInvalidLogin)
+	}
+
+	if _, err := provider.Login("alice@example.com", "secret"); err != ErrInvalidLogin {
+		t.Errorf("unknown user: got %v, want %v", err, ErrInvalidLogin)
+	}
+
+	if _, err := provider.RequestSigningKeys("app", "wrong"); err != ErrNoJWTKeys {
+		t.Errorf("wrong service token: got %v, want %v", err, ErrNoJWTKeys)
+	}
+
+	keys, err := provider.RequestSigningKeys("app", "app-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := f.SigningKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *keys != *want {
+		t.Errorf("got signing keys %+v, want %+v", keys, want)
+	}
+
+	publicKey, err := keys.VerificationKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := provider.Login("bob@example.com", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := jwt.Parse(token.String(), func(*jwt.Token) (interface{}, error) {
+		return publicKey, nil
+	})
+	if err != nil {
+		t.Fatalf("token doesn't verify with the handed out keys: %v", err)
+	}
+
+	p := NewPrincipal(parsed.Claims.(jwt.MapClaims))
+	if p.ID != "1" || p.Username != "bob@example.com" || !reflect.DeepEqual(p.Roles, []string{"admin"}) {
+		t.Errorf("got principal %+v", p)
+	}
+
+	if tenant, _ := p.Claim("tenant"); tenant != "acme" {
+		t.Errorf("got tenant %v, want acme", tenant)
+	}
+}
@@ -0,0 +1,250 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	// DefaultAccessTokenTTL is the lifetime of tokens minted by an Issuer.
+	DefaultAccessTokenTTL = 15 * time.Minute
+
+	// DefaultRefreshTokenTTL is the lifetime of refresh tokens issued by an Issuer.
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// ErrNoRefreshStore is returned when refresh tokens are used with an
+// Issuer that has no RefreshTokenStore.
+var ErrNoRefreshStore = errors.New("issuer has no refresh token store")
+
+type (
+	// Issuer mints signed tokens with a private key, e.g. the one handed
+	// to a service in its SigningKeys. RSA keys sign RS256 tokens. Every
+	// token gets "iat", "nbf", "exp" and a random "jti", plus "iss" and
+	// "aud" if configured, unless the caller's claims set them.
+	Issuer struct {
+		key    crypto.Signer
+		method jwt.SigningMethod
+
+		// KeyID is sent as the "kid" header, if set.
+		KeyID string
+
+		// Issuer and Audience are set as the "iss" and "aud" claims, if set.
+		Issuer   string
+		Audience string
+
+		// TTL is the lifetime of minted tokens.
+		TTL time.Duration
+
+		// RefreshTTL is the lifetime of refresh tokens.
+		RefreshTTL time.Duration
+
+		// Refresh stores refresh tokens. IssuePair and RefreshTokens
+		// return ErrNoRefreshStore without one.
+		Refresh RefreshTokenStore
+	}
+
+	// TokenPair is an access token and the refresh token to renew it with.
+	TokenPair struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+	}
+)
+
+// NewIssuer returns an Issuer signing with the private key of the
+// signing keys.
+func NewIssuer(keys *SigningKeys, keyID string) (*Issuer, error) {
+	key, err := ParsePrivateKey(keys.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewIssuerWithKey(key, keyID)
+}
+
+// NewIssuerWithKey returns an Issuer signing with the given RSA, ECDSA
+// or Ed25519 private key, using the key's DefaultAlgorithm.
+func NewIssuerWithKey(key crypto.Signer, keyID string) (*Issuer, error) {
+	alg, err := DefaultAlgorithm(key.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Issuer{
+		key:        key,
+		method:     jwt.GetSigningMethod(alg),
+		KeyID:      keyID,
+		TTL:        DefaultAccessTokenTTL,
+		RefreshTTL: DefaultRefreshTokenTTL,
+	}, nil
+}
+
+// PublicKey returns the key tokens of the issuer are verified with.
+func (i *Issuer) PublicKey() crypto.PublicKey {
+	return i.key.Public()
+}
+
+// JWKS returns a JWKS holding the issuer's public key under its KeyID,
+// for services verifying its tokens with a JWKSProvider.
+func (i *Issuer) JWKS() *JWKS {
+	var jwk JWK
+
+	switch pub := i.key.Public().(type) {
+	case *rsa.PublicKey:
+		jwk = NewRSAJWK(i.KeyID, pub)
+	case *ecdsa.PublicKey:
+		jwk = NewECDSAJWK(i.KeyID, pub)
+	case ed25519.PublicKey:
+		jwk = NewEd25519JWK(i.KeyID, pub)
+	}
+
+	return &JWKS{Keys: []JWK{jwk}}
+}
+
+// Keyfunc returns the issuer's public key for tokens signed with its
+// algorithm, to verify its tokens within the same process.
+func (i *Issuer) Keyfunc(t *jwt.Token) (interface{}, error) {
+	if t.Method.Alg() != i.method.Alg() {
+		return nil, ErrKeyAlgMismatch
+	}
+
+	return i.key.Public(), nil
+}
+
+// Issue mints a token with the given claims and the issuer's TTL.
+func (i *Issuer) Issue(claims map[string]interface{}) (Token, error) {
+	return i.IssueWithTTL(claims, i.TTL)
+}
+
+// IssueWithTTL mints a token with the given claims and lifetime.
+func (i *Issuer) IssueWithTTL(claims map[string]interface{}, ttl time.Duration) (Token, error) {
+	jti, err := randomString(16, hex.EncodeToString)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	mapClaims := jwt.MapClaims{
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
+		"exp": now.Add(ttl).Unix(),
+		"jti": jti,
+	}
+
+	if i.Issuer != "" {
+		mapClaims["iss"] = i.Issuer
+	}
+
+	if i.Audience != "" {
+		mapClaims["aud"] = i.Audience
+	}
+
+	for k, v := range claims {
+		mapClaims[k] = v
+	}
+
+	token := jwt.NewWithClaims(i.method, mapClaims)
+	if i.KeyID != "" {
+		token.Header["kid"] = i.KeyID
+	}
+
+	signedToken, err := token.SignedString(i.key)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(signedToken), nil
+}
+
+// IssuePair mints an access token with the given claims and a refresh
+// token starting a new family.
+func (i *Issuer) IssuePair(claims map[string]interface{}) (*TokenPair, error) {
+	family, err := randomString(16, hex.EncodeToString)
+	if err != nil {
+		return nil, err
+	}
+
+	return i.issuePair(family, claims)
+}
+
+// RefreshTokens exchanges a refresh token for a new pair with the same
+// claims. Each refresh token can be used once; presenting it again
+// revokes its family and returns ErrRefreshTokenReused.
+func (i *Issuer) RefreshTokens(refreshToken string) (*TokenPair, error) {
+	if i.Refresh == nil {
+		return nil, ErrNoRefreshStore
+	}
+
+	t, reused, err := i.Refresh.Use(hashSecret(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+
+	if reused {
+		if err := i.Refresh.RevokeFamily(t.Family); err != nil {
+			return nil, err
+		}
+
+		return nil, ErrRefreshTokenReused
+	}
+
+	return i.issuePair(t.Family, t.Claims)
+}
+
+// RevokeRefreshToken revokes the family of the refresh token, e.g. on logout.
+func (i *Issuer) RevokeRefreshToken(refreshToken string) error {
+	if i.Refresh == nil {
+		return ErrNoRefreshStore
+	}
+
+	family, _, ok := splitSecretToken(refreshToken)
+	if !ok {
+		return ErrInvalidRefreshToken
+	}
+
+	return i.Refresh.RevokeFamily(family)
+}
+
+func (i *Issuer) issuePair(family string, claims map[string]interface{}) (*TokenPair, error) {
+	if i.Refresh == nil {
+		return nil, ErrNoRefreshStore
+	}
+
+	secret, err := randomString(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken := family + "." + secret
+
+	err = i.Refresh.Save(&RefreshToken{
+		Hash:      hashSecret(refreshToken),
+		Family:    family,
+		Claims:    claims,
+		ExpiresAt: time.Now().Add(i.RefreshTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := i.Issue(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken.String(),
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(i.TTL / time.Second),
+	}, nil
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// newTestIssuer returns an Issuer signing ES256 tokens with a new key.
+func newTestIssuer(t *testing.T) *Issuer {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuer, err := NewIssuerWithKey(key, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return issuer
+}
+
+func TestIssuerRefreshRotation(t *testing.T) {
+	issuer := newTestIssuer(t)
+	issuer.Refresh = NewMemoryRefreshStore()
+
+	pair, err := issuer.IssuePair(map[string]interface{}{"username": "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next, err := issuer.RefreshTokens(pair.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if next.RefreshToken == pair.RefreshToken {
+		t.Error("refresh token not rotated")
+	}
+
+	parsed, err := jwt.Parse(next.AccessToken, issuer.Keyfunc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims := parsed.Claims.(jwt.MapClaims); claims["username"] != "bob" {
+		t.Errorf("got claims %v after refresh, want username bob", claims)
+	}
+
+	// Replaying the exchanged token revokes the family, including the
+	// token it was exchanged for.
+	if _, err := issuer.RefreshTokens(pair.RefreshToken); err != ErrRefreshTokenReused {
+		t.Errorf("replayed refresh token: got %v, want %v", err, ErrRefreshTokenReused)
+	}
+
+	if _, err := issuer.RefreshTokens(next.RefreshToken); err != ErrInvalidRefreshToken {
+		t.Errorf("refresh token of a revoked family: got %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
+
+func TestIssuerRevokeRefreshToken(t *testing.T) {
+	issuer := newTestIssuer(t)
+	issuer.Refresh = NewMemoryRefreshStore()
+
+	pair, err := issuer.IssuePair(map[string]interface{}{"username": "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := issuer.RevokeRefreshToken(pair.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := issuer.RefreshTokens(pair.RefreshToken); err != ErrInvalidRefreshToken {
+		t.Errorf("revoked refresh token: got %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
+
+func TestIssuerExpiry(t *testing.T) {
+	issuer := newTestIssuer(t)
+	issuer.Refresh = NewMemoryRefreshStore()
+	issuer.TTL = -time.Minute
+	issuer.RefreshTTL = -time.Minute
+
+	pair, err := issuer.IssuePair(map[string]interface{}{"username": "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = jwt.Parse(pair.AccessToken, issuer.Keyfunc)
+
+	var ve *jwt.ValidationError
+	if !errors.As(err, &ve) || ve.Errors&jwt.ValidationErrorExpired == 0 {
+		t.Errorf("expired access token: got %v, want an expiry error", err)
+	}
+
+	if _, err := issuer.RefreshTokens(pair.RefreshToken); err != ErrInvalidRefreshToken {
+		t.Errorf("expired refresh token: got %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
+
+func TestIssuerWithoutRefreshStore(t *testing.T) {
+	issuer := newTestIssuer(t)
+
+	if _, err := issuer.IssuePair(nil); err != ErrNoRefreshStore {
+		t.Errorf("got %v, want %v", err, ErrNoRefreshStore)
+	}
+}
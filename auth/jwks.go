@@ -0,0 +1,451 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/zjeremiah/stdlib/xhttp"
+)
+
+var (
+	// ErrNoKeyID is returned when a JWT does not carry a "kid" header and
+	// the JWKS doesn't have exactly one key for its algorithm.
+	ErrNoKeyID = errors.New("token has no key id")
+
+	// ErrUnknownKeyID is returned when no key in the JWKS matches a token's "kid" header.
+	ErrUnknownKeyID = errors.New("unknown key id")
+
+	// ErrUnsupportedKey is returned when a JWK has a key type this package cannot use.
+	ErrUnsupportedKey = errors.New("unsupported key type")
+
+	// ErrKeyAlgMismatch is returned when a token's algorithm does not match the key it names.
+	ErrKeyAlgMismatch = errors.New("token algorithm does not match key")
+)
+
+// DefaultJWKSMinRefreshInterval is the shortest time a JWKSProvider waits
+// between two fetches triggered by unknown key ids.
+const DefaultJWKSMinRefreshInterval = 10 * time.Second
+
+type (
+	// JWK is a single JSON Web Key as described in RFC 7517.
+	JWK struct {
+		KeyType   string `json:"kty"`
+		KeyID     string `json:"kid"`
+		Use       string `json:"use,omitempty"`
+		Algorithm string `json:"alg,omitempty"`
+
+		// RSA
+		N string `json:"n,omitempty"`
+		E string `json:"e,omitempty"`
+
+		// EC and OKP
+		Curve string `json:"crv,omitempty"`
+		X     string `json:"x,omitempty"`
+		Y     string `json:"y,omitempty"`
+	}
+
+	// JWKS is a JSON Web Key Set document.
+	JWKS struct {
+		Keys []JWK `json:"keys"`
+	}
+
+	// JWKSProvider fetches a JWKS document and hands out the
+	// verification key matching a token's "kid" header. Keys are
+	// cached and the document is fetched again when an unknown
+	// key id shows up, so key rotation on the auth server is picked
+	// up without a restart.
+	JWKSProvider struct {
+		url    string
+		client xhttp.Client
+
+		// MinRefreshInterval limits how often an unknown key id
+		// can cause the JWKS to be fetched again.
+		MinRefreshInterval time.Duration
+
+		// Algorithms is the allowlist of token algorithms. If empty,
+		// a key accepts the "alg" published in its JWK, or its
+		// auth.DefaultAlgorithm if the JWK has none.
+		Algorithms []string
+
+		mu          sync.RWMutex
+		keys        map[string]jwksKey
+		lastAttempt time.Time
+
+		fetchMu sync.Mutex
+	}
+
+	jwksKey struct {
+		key interface{}
+		alg string
+	}
+)
+
+// NewJWKSProvider returns a JWKSProvider that reads keys from the JWKS
+// document at jwksURL.
+func NewJWKSProvider(jwksURL string) *JWKSProvider {
+	return NewJWKSProviderWithClient(jwksURL, xhttp.NewDefaultClient())
+}
+
+// NewJWKSProviderWithClient returns a JWKSProvider that reads keys from the
+// JWKS document at jwksURL using the given client.
+func NewJWKSProviderWithClient(jwksURL string, client xhttp.Client) *JWKSProvider {
+	return &JWKSProvider{
+		url:                jwksURL,
+		client:             client,
+		MinRefreshInterval: DefaultJWKSMinRefreshInterval,
+		keys:               make(map[string]jwksKey),
+	}
+}
+
+// Key returns the verification key with the given key id. If the key is
+// not cached, the JWKS is fetched again, at most once per MinRefreshInterval.
+func (j *JWKSProvider) Key(kid string) (interface{}, error) {
+	k, err := j.lookup(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	return k.key, nil
+}
+
+// Keyfunc is a jwt.Keyfunc that resolves a token's verification key
+// by its "kid" header. Tokens without one are verified with the only key
+// usable for their algorithm, if there is exactly one.
+func (j *JWKSProvider) Keyfunc(t *jwt.Token) (interface{}, error) {
+	kid, ok := t.Header["kid"].(string)
+	if !ok || kid == "" {
+		k, err := j.soleKey(t.Method.Alg())
+		if err != nil {
+			return nil, err
+		}
+
+		return k.key, nil
+	}
+
+	k, err := j.lookup(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := j.checkKey(k, t.Method.Alg()); err != nil {
+		return nil, err
+	}
+
+	return k.key, nil
+}
+
+// Refresh fetches the JWKS document and replaces the cached keys.
+func (j *JWKSProvider) Refresh() error {
+	j.fetchMu.Lock()
+	defer j.fetchMu.Unlock()
+
+	return j.fetch()
+}
+
+func (j *JWKSProvider) lookup(kid string) (jwksKey, error) {
+	j.mu.RLock()
+	k, ok := j.keys[kid]
+	j.mu.RUnlock()
+
+	if ok {
+		return k, nil
+	}
+
+	j.fetchMu.Lock()
+	defer j.fetchMu.Unlock()
+
+	// Another caller may have fetched the key while we waited.
+	j.mu.RLock()
+	k, ok = j.keys[kid]
+	lastAttempt := j.lastAttempt
+	j.mu.RUnlock()
+
+	if ok {
+		return k, nil
+	}
+
+	if time.Since(lastAttempt) < j.MinRefreshInterval {
+		return jwksKey{}, ErrUnknownKeyID
+	}
+
+	if err := j.fetch(); err != nil {
+		return jwksKey{}, err
+	}
+
+	j.mu.RLock()
+	k, ok = j.keys[kid]
+	j.mu.RUnlock()
+
+	if !ok {
+		return jwksKey{}, ErrUnknownKeyID
+	}
+
+	return k, nil
+}
+
+// soleKey returns the only cached key usable for alg. If there is none,
+// the JWKS is fetched again, at most once per MinRefreshInterval.
+func (j *JWKSProvider) soleKey(alg string) (jwksKey, error) {
+	if k, ok := j.usableKey(alg); ok {
+		return k, nil
+	}
+
+	j.fetchMu.Lock()
+	defer j.fetchMu.Unlock()
+
+	j.mu.RLock()
+	lastAttempt := j.lastAttempt
+	j.mu.RUnlock()
+
+	if time.Since(lastAttempt) >= j.MinRefreshInterval {
+		if err := j.fetch(); err != nil {
+			return jwksKey{}, err
+		}
+	}
+
+	if k, ok := j.usableKey(alg); ok {
+		return k, nil
+	}
+
+	return jwksKey{}, ErrNoKeyID
+}
+
+// usableKey returns the cached key usable for alg, unless there are
+// none or several.
+func (j *JWKSProvider) usableKey(alg string) (jwksKey, bool) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	var (
+		found jwksKey
+		n     int
+	)
+
+	for _, k := range j.keys {
+		if j.checkKey(k, alg) == nil {
+			found = k
+			n++
+		}
+	}
+
+	return found, n == 1
+}
+
+// checkKey returns an error unless the key can verify tokens using alg.
+func (j *JWKSProvider) checkKey(k jwksKey, alg string) error {
+	if k.alg != "" && k.alg != alg {
+		return ErrKeyAlgMismatch
+	}
+
+	allowed := j.Algorithms
+	if len(allowed) == 0 && k.alg != "" {
+		allowed = []string{k.alg}
+	}
+
+	return CheckAlgorithm(k.key, alg, allowed)
+}
+
+// fetch must be called with fetchMu held. Failed attempts count towards
+// MinRefreshInterval too, so unknown key ids can't hammer a failing endpoint.
+// Keys that can't be parsed are skipped, unless none of the keys can be.
+func (j *JWKSProvider) fetch() error {
+	j.mu.Lock()
+	j.lastAttempt = time.Now()
+	j.mu.Unlock()
+
+	req, err := http.NewRequest("GET", j.url, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("could not get JWKS: %s", resp.Status)
+	}
+
+	set := new(JWKS)
+	if err := json.Unmarshal(b, set); err != nil {
+		return err
+	}
+
+	keys := make(map[string]jwksKey, len(set.Keys))
+
+	var lastErr error
+
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.PublicKey()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		keys[jwk.KeyID] = jwksKey{key: key, alg: jwk.Algorithm}
+	}
+
+	if len(keys) == 0 && lastErr != nil && lastErr != ErrUnsupportedKey {
+		return lastErr
+	}
+
+	j.mu.Lock()
+	j.keys = keys
+	j.mu.Unlock()
+
+	return nil
+}
+
+// PublicKey returns the public key described by the JWK.
+func (k JWK) PublicKey() (interface{}, error) {
+	switch k.KeyType {
+	case "RSA":
+		return k.rsaPublicKey()
+	case "EC":
+		return k.ecdsaPublicKey()
+	case "OKP":
+		return k.ed25519PublicKey()
+	default:
+		return nil, ErrUnsupportedKey
+	}
+}
+
+func (k JWK) rsaPublicKey() (interface{}, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(n) == 0 || len(e) == 0 {
+		return nil, fmt.Errorf("jwk %q: missing RSA modulus or exponent", k.KeyID)
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
+
+func (k JWK) ecdsaPublicKey() (interface{}, error) {
+	var curve elliptic.Curve
+
+	switch k.Curve {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, ErrUnsupportedKey
+	}
+
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, err
+	}
+
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil {
+		return nil, err
+	}
+
+	pub := &ecdsa.PublicKey{
+		Curve: curve,
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}
+
+	if !curve.IsOnCurve(pub.X, pub.Y) {
+		return nil, fmt.Errorf("jwk %q: point is not on curve %s", k.KeyID, k.Curve)
+	}
+
+	return pub, nil
+}
+
+func (k JWK) ed25519PublicKey() (interface{}, error) {
+	if k.Curve != "Ed25519" {
+		return nil, ErrUnsupportedKey
+	}
+
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(x) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("jwk %q: invalid Ed25519 key size", k.KeyID)
+	}
+
+	return ed25519.PublicKey(x), nil
+}
+
+// NewRSAJWK returns the JWK representation of an RSA public key.
+func NewRSAJWK(kid string, pub *rsa.PublicKey) JWK {
+	return JWK{
+		KeyType:   "RSA",
+		KeyID:     kid,
+		Use:       "sig",
+		Algorithm: jwt.SigningMethodRS256.Alg(),
+		N:         base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
+
+// NewECDSAJWK returns the JWK representation of an ECDSA public key.
+func NewECDSAJWK(kid string, pub *ecdsa.PublicKey) JWK {
+	size := (pub.Curve.Params().BitSize + 7) / 8
+
+	return JWK{
+		KeyType:   "EC",
+		KeyID:     kid,
+		Use:       "sig",
+		Algorithm: ecdsaAlgorithm(pub),
+		Curve:     pub.Curve.Params().Name,
+		X:         base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size))),
+		Y:         base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size))),
+	}
+}
+
+// NewEd25519JWK returns the JWK representation of an Ed25519 public key.
+func NewEd25519JWK(kid string, pub ed25519.PublicKey) JWK {
+	return JWK{
+		KeyType:   "OKP",
+		KeyID:     kid,
+		Use:       "sig",
+		Algorithm: jwt.SigningMethodEdDSA.Alg(),
+		Curve:     "Ed25519",
+		X:         base64.RawURLEncoding.EncodeToString(pub),
+	}
+}
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func TestJWKSProviderLimitsFailedFetches(t *testing.T) {
+	var requests int64
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	provider := NewJWKSProviderWithClient(server.URL, http.DefaultClient)
+	provider.MinRefreshInterval = time.Hour
+
+	for _, kid := range []string{"a", "b", "c", "d"} {
+		if _, err := provider.lookup(kid); err == nil {
+			t.Fatalf("lookup of %q succeeded against a failing endpoint", kid)
+		}
+	}
+
+	if n := atomic.LoadInt64(&requests); n != 1 {
+		t.Errorf("got %d fetches for unknown key ids, want 1", n)
+	}
+}
+
+func TestJWKSProviderSkipsMalformedKeys(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := JWKS{Keys: []JWK{
+		{KeyType: "RSA", KeyID: "broken", N: "!!!", E: "AQAB"},
+		NewRSAJWK("good", &key.PublicKey),
+	}}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(set)
+	}))
+	defer server.Close()
+
+	provider := NewJWKSProviderWithClient(server.URL, http.DefaultClient)
+	if err := provider.Refresh(); err != nil {
+		t.Fatalf("refresh failed because of a malformed key: %v", err)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"username": "bob"})
+	token.Header["kid"] = "good"
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := jwt.Parse(signed, provider.Keyfunc); err != nil {
+		t.Errorf("token signed with the good key rejected: %v", err)
+	}
+}
+
+func TestJWKSProviderTokenWithoutKeyID(t *testing.T) {
+	rs256, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs512, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other512 := NewRSAJWK("rs512", &rs512.PublicKey)
+	other512.Algorithm = jwt.SigningMethodRS512.Alg()
+
+	set := JWKS{Keys: []JWK{NewRSAJWK("rs256", &rs256.PublicKey), other512}}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(set)
+	}))
+	defer server.Close()
+
+	provider := NewJWKSProviderWithClient(server.URL, http.DefaultClient)
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"username": "bob"}).SignedString(rs256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := jwt.Parse(signed, provider.Keyfunc); err != nil {
+		t.Errorf("token without kid rejected with a single RS256 key: %v", err)
+	}
+
+	another, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set.Keys = append(set.Keys, NewRSAJWK("another", &another.PublicKey))
+
+	if err := provider.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = jwt.Parse(signed, provider.Keyfunc)
+
+	var ve *jwt.ValidationError
+	if !errors.As(err, &ve) || ve.Inner != ErrNoKeyID {
+		t.Errorf("token without kid with two RS256 keys: got %v, want %v", err, ErrNoKeyID)
+	}
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ErrKeyCacheCorrupt is returned when a signing key cache file can't be
+// decrypted, e.g. because it was written with a different secret.
+var ErrKeyCacheCorrupt = errors.New("signing key cache is corrupt or was written with another secret")
+
+// SaveSigningKeys writes the keys to path, encrypted with AES-GCM under a
+// key derived from secret. The file is replaced atomically and is only
+// readable by its owner.
+func SaveSigningKeys(path string, keys *SigningKeys, secret string) error {
+	plain, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+
+	gcm, err := keyCacheCipher(secret)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, plain, nil)
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(sealed); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadSigningKeys reads keys written by SaveSigningKeys with the same secret.
+func LoadSigningKeys(path, secret string) (*SigningKeys, error) {
+	sealed, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := keyCacheCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrKeyCacheCorrupt
+	}
+
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrKeyCacheCorrupt
+	}
+
+	keys := new(SigningKeys)
+	if err := json.Unmarshal(plain, keys); err != nil {
+		return nil, ErrKeyCacheCorrupt
+	}
+
+	return keys, nil
+}
+
+func keyCacheCipher(secret string) (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte("stdlib signing key cache:" + secret))
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
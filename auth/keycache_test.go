@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSigningKeyCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.cache")
+	keys := &SigningKeys{PublicKey: "public", PrivateKey: "private"}
+
+	if err := SaveSigningKeys(path, keys, "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("got file mode %o, want 600", mode)
+	}
+
+	sealed, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, plain := range []string{"public", "private"} {
+		if bytes.Contains(sealed, []byte(plain)) {
+			t.Errorf("cache file contains %q in plain text", plain)
+		}
+	}
+
+	loaded, err := LoadSigningKeys(path, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *loaded != *keys {
+		t.Errorf("got keys %+v, want %+v", loaded, keys)
+	}
+
+	if _, err := LoadSigningKeys(path, "other secret"); err != ErrKeyCacheCorrupt {
+		t.Errorf("other secret: got %v, want %v", err, ErrKeyCacheCorrupt)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("short"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadSigningKeys(path, "secret"); err != ErrKeyCacheCorrupt {
+		t.Errorf("truncated file: got %v, want %v", err, ErrKeyCacheCorrupt)
+	}
+
+	if _, err := LoadSigningKeys(filepath.Join(t.TempDir(), "missing"), "secret"); !os.IsNotExist(err) {
+		t.Errorf("missing file: got %v, want a not exist error", err)
+	}
+}
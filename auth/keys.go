@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrInvalidPublicKey is returned when a public key is not valid PEM or base64 PEM.
+	ErrInvalidPublicKey = errors.New("invalid public key")
+
+	// ErrInvalidPrivateKey is returned when a private key is not valid PEM or base64 PEM.
+	ErrInvalidPrivateKey = errors.New("invalid private key")
+
+	// ErrPrivateKeyExposed is returned when the auth service hands out a
+	// private key to a service that only needs to verify tokens.
+	ErrPrivateKeyExposed = errors.New("auth service returned a private key")
+)
+
+// VerificationKey parses the PublicKey of the signing keys. It never
+// touches the private key.
+func (k *SigningKeys) VerificationKey() (crypto.PublicKey, error) {
+	return ParsePublicKey(k.PublicKey)
+}
+
+// ParsePublicKey parses an RSA, ECDSA or Ed25519 public key. The key may be PEM
+// encoded or base64 encoded PEM, as a PKIX public key, a PKCS #1 RSA
+// public key or a certificate.
+func ParsePublicKey(s string) (crypto.PublicKey, error) {
+	b, err := decodePEM(s)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, ErrInvalidPublicKey
+	}
+
+	var key interface{}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+
+		cert, err = x509.ParseCertificate(block.Bytes)
+		if err == nil {
+			key = cert.PublicKey
+		}
+	default:
+		return nil, ErrInvalidPublicKey
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	default:
+		return nil, ErrUnsupportedKey
+	}
+}
+
+// ParsePrivateKey parses an RSA, ECDSA or Ed25519 private key. The key may
+// be PEM encoded or base64 encoded PEM, as PKCS #1, SEC 1 or PKCS #8.
+func ParsePrivateKey(s string) (crypto.Signer, error) {
+	b, err := decodePEM(s)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, ErrInvalidPrivateKey
+	}
+
+	var key interface{}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, ErrInvalidPrivateKey
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return k, nil
+	case *ecdsa.PrivateKey:
+		return k, nil
+	case ed25519.PrivateKey:
+		return k, nil
+	default:
+		return nil, ErrUnsupportedKey
+	}
+}
+
+// decodePEM returns s as PEM bytes, decoding it from base64 if needed.
+func decodePEM(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+
+	if strings.HasPrefix(s, "-----BEGIN") {
+		return []byte(s), nil
+	}
+
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("key is neither PEM nor base64 encoded PEM")
+	}
+
+	return b, nil
+}
@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func pemString(t *testing.T, typ string, der []byte, err error) string {
+	t.Helper()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}))
+}
+
+func TestParsePublicKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkixPEM := func(pub crypto.PublicKey) string {
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		return pemString(t, "PUBLIC KEY", der, err)
+	}
+
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "auth"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &ecKey.PublicKey, ecKey)
+	cert := pemString(t, "CERTIFICATE", certDER, err)
+
+	tests := []struct {
+		name string
+		key  string
+		want crypto.PublicKey
+	}{
+		{"rsa pkix", pkixPEM(&rsaKey.PublicKey), &rsaKey.PublicKey},
+		{"rsa pkcs1", pemString(t, "RSA PUBLIC KEY", x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey), nil), &rsaKey.PublicKey},
+		{"ecdsa", pkixPEM(&ecKey.PublicKey), &ecKey.PublicKey},
+		{"ed25519", pkixPEM(edPub), edPub},
+		{"base64 pem", base64.StdEncoding.EncodeToString([]byte(pkixPEM(&ecKey.PublicKey))), &ecKey.PublicKey},
+		{"certificate", cert, &ecKey.PublicKey},
+	}
+
+	for _, tt := range tests {
+		key, err := ParsePublicKey(tt.key)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		} else if !reflect.DeepEqual(key, tt.want) {
+			t.Errorf("%s: got a different key", tt.name)
+		}
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	private := pemString(t, "PRIVATE KEY", privateDER, err)
+
+	for _, s := range []string{"", "not a key", private} {
+		if _, err := ParsePublicKey(s); err == nil {
+			t.Errorf("%q parsed as a public key", s)
+		}
+	}
+}
+
+func TestSigningKeysVerificationKeyIgnoresPrivateKey(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+
+	keys := &SigningKeys{
+		PublicKey:  pemString(t, "PUBLIC KEY", der, err),
+		PrivateKey: "not even a key",
+	}
+
+	key, err := keys.VerificationKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(key, &ecKey.PublicKey) {
+		t.Error("got a different key")
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkcs8 := func(key crypto.Signer) string {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		return pemString(t, "PRIVATE KEY", der, err)
+	}
+
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	sec1 := pemString(t, "EC PRIVATE KEY", ecDER, err)
+
+	tests := []struct {
+		name string
+		key  string
+		want crypto.Signer
+	}{
+		{"rsa pkcs1", pemString(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey), nil), rsaKey},
+		{"rsa pkcs8", pkcs8(rsaKey), rsaKey},
+		{"ecdsa sec1", sec1, ecKey},
+		{"ecdsa pkcs8", pkcs8(ecKey), ecKey},
+		{"ed25519", pkcs8(edKey), edKey},
+		{"base64 pem", base64.StdEncoding.EncodeToString([]byte(sec1)), ecKey},
+	}
+
+	for _, tt := range tests {
+		key, err := ParsePrivateKey(tt.key)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		} else if !reflect.DeepEqual(key.Public(), tt.want.Public()) {
+			t.Errorf("%s: got a different key", tt.name)
+		}
+	}
+}
@@ -0,0 +1,385 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/zjeremiah/stdlib/data"
+)
+
+// DefaultPasswordResetTTL is how long a password reset token can be used.
+const DefaultPasswordResetTTL = time.Hour
+
+var (
+	// ErrUserExists is returned when creating a user whose username is taken.
+	ErrUserExists = errors.New("user already exists")
+
+	// ErrUserNotFound is returned for unknown users.
+	ErrUserNotFound = errors.New("user not found")
+
+	// ErrInvalidResetToken is returned when a password reset token is
+	// malformed, unknown, used or expired.
+	ErrInvalidResetToken = errors.New("invalid password reset token")
+)
+
+// LocalUserSchema creates the table used by LocalProvider. Times are
+// stored as unix seconds. Roles are comma separated.
+const LocalUserSchema = `
+CREATE TABLE IF NOT EXISTS local_users (
+	id            VARCHAR(64) PRIMARY KEY,
+	username      VARCHAR(255) NOT NULL UNIQUE,
+	password_hash VARCHAR(255) NOT NULL,
+	roles         TEXT NOT NULL,
+	created_at    BIGINT NOT NULL,
+	updated_at    BIGINT NOT NULL
+);`
+
+// PasswordResetSchema creates the table LocalProvider keeps password
+// reset tokens in. Only SHA-256 hashes of their secrets are stored.
+const PasswordResetSchema = `
+CREATE TABLE IF NOT EXISTS password_resets (
+	id         VARCHAR(64) PRIMARY KEY,
+	hash       VARCHAR(64) NOT NULL,
+	user_id    VARCHAR(64) NOT NULL,
+	expires_at BIGINT NOT NULL
+);`
+
+const localUserColumns = `id, username, password_hash, roles, created_at, updated_at`
+
+type (
+	// LocalUser is a user stored in the table from LocalUserSchema.
+	LocalUser struct {
+		ID           string `db:"id"`
+		Username     string `db:"username"`
+		PasswordHash string `db:"password_hash"`
+		Roles        string `db:"roles"`
+		CreatedAt    int64  `db:"created_at"`
+		UpdatedAt    int64  `db:"updated_at"`
+	}
+
+	// LocalProvider is a Provider authenticating users stored in the
+	// table from LocalUserSchema, for tools that don't use the RM Auth
+	// server. Tokens are signed by its Issuer with the "id", "username"
+	// and "roles" claims RMAuthJWT expects. As a KeyfuncProvider it can
+	// be passed to api.SetupAuth as AuthOptions.Provider.
+	LocalProvider struct {
+		db     data.SqlxWrapper
+		issuer *Issuer
+
+		// Hasher hashes new passwords. Passwords stored with another
+		// algorithm or other parameters are rehashed on the next login.
+		Hasher PasswordHasher
+
+		// ResetTTL is how long password reset tokens can be used.
+		ResetTTL time.Duration
+
+		// Revocations, if set, revokes a user's tokens when their
+		// password is changed or reset.
+		Revocations RevocationStore
+
+		dummyOnce sync.Once
+		dummyHash string
+	}
+
+	passwordReset struct {
+		ID        string `db:"id"`
+		Hash      string `db:"hash"`
+		UserID    string `db:"user_id"`
+		ExpiresAt int64  `db:"expires_at"`
+	}
+)
+
+// NewLocalProvider returns a LocalProvider using the given database and
+// signing tokens with the issuer. Passwords are hashed with
+// DefaultArgon2idHasher.
+func NewLocalProvider(db data.SqlxWrapper, issuer *Issuer) *LocalProvider {
+	return &LocalProvider{
+		db:       db,
+		issuer:   issuer,
+		Hasher:   DefaultArgon2idHasher,
+		ResetTTL: DefaultPasswordResetTTL,
+	}
+}
+
+// Login checks the password and returns a token for the user. The
+// password is rehashed if the Hasher's parameters changed.
+func (p *LocalProvider) Login(username, password string) (Token, error) {
+	user, err := p.user(p.db, `username = ?`, username)
+	if err == ErrUserNotFound {
+		// Hash anyway, so unknown usernames can't be told apart by timing.
+		VerifyPassword(p.dummyPasswordHash(), password)
+		return nil, ErrInvalidLogin
+	} else if err != nil {
+		return nil, err
+	}
+
+	ok, err := VerifyPassword(user.PasswordHash, password)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, ErrInvalidLogin
+	}
+
+	if p.Hasher.NeedsRehash(user.PasswordHash) {
+		if err := p.setPasswordHash(p.db, user.ID, password); err != nil {
+			return nil, err
+		}
+	}
+
+	return p.issuer.Issue(map[string]interface{}{
+		"id":       user.ID,
+		"username": user.Username,
+		"roles":    toInterfaces(user.RoleList()),
+	})
+}
+
+// RequestSigningKeys returns ErrSigningKeysUnsupported, as the issuer's
+// private key is never handed out. Use Keyfunc to verify tokens.
+func (p *LocalProvider) RequestSigningKeys(name, token string) (*SigningKeys, error) {
+	return nil, ErrSigningKeysUnsupported
+}
+
+// Keyfunc verifies tokens with the issuer's public key. Other services
+// can verify them against the issuer's JWKS.
+func (p *LocalProvider) Keyfunc(t *jwt.Token) (interface{}, error) {
+	return p.issuer.Keyfunc(t)
+}
+
+// CreateUser stores a new user with the password and roles.
+func (p *LocalProvider) CreateUser(username, password string, roles []string) (*LocalUser, error) {
+	id, err := randomString(16, hex.EncodeToString)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := p.Hasher.Hash(password)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+
+	user := &LocalUser{
+		ID:           id,
+		Username:     username,
+		PasswordHash: hash,
+		Roles:        strings.Join(roles, ","),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	if err := p.checkUsernameFree(username); err != nil {
+		return nil, err
+	}
+
+	_, err = p.db.NamedExec(`INSERT INTO local_users (`+localUserColumns+`)
+		VALUES (:id, :username, :password_hash, :roles, :created_at, :updated_at)`, user)
+	if err != nil {
+		// A concurrent CreateUser may have taken the username since the
+		// check, failing the insert on its UNIQUE constraint.
+		if checkErr := p.checkUsernameFree(username); checkErr != nil {
+			return nil, checkErr
+		}
+
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// User returns the user with the username.
+func (p *LocalProvider) User(username string) (*LocalUser, error) {
+	return p.user(p.db, `username = ?`, username)
+}
+
+// SetRoles replaces the user's roles. Tokens issued before keep the old roles.
+func (p *LocalProvider) SetRoles(userID string, roles []string) error {
+	return p.update(p.db, `UPDATE local_users SET roles = ?, updated_at = ? WHERE id = ?`, strings.Join(roles, ","), time.Now().Unix(), userID)
+}
+
+// SetPassword replaces the user's password.
+func (p *LocalProvider) SetPassword(userID, password string) error {
+	if err := p.setPasswordHash(p.db, userID, password); err != nil {
+		return err
+	}
+
+	return p.revokeTokens(userID)
+}
+
+// DeleteUser removes the user and any password reset tokens.
+func (p *LocalProvider) DeleteUser(userID string) error {
+	err := data.WithTransaction(p.db, func(tx data.TxWrapper) error {
+		if _, err := tx.Exec(tx.Rebind(`DELETE FROM password_resets WHERE user_id = ?`), userID); err != nil {
+			return err
+		}
+
+		return p.update(tx, `DELETE FROM local_users WHERE id = ?`, userID)
+	})
+	if err != nil {
+		return err
+	}
+
+	return p.revokeTokens(userID)
+}
+
+// CreatePasswordReset returns a token that lets the user set a new
+// password with ResetPassword within the ResetTTL, e.g. by mailing a link
+// containing it. Earlier reset tokens of the user stop working.
+func (p *LocalProvider) CreatePasswordReset(username string) (string, error) {
+	user, err := p.User(username)
+	if err != nil {
+		return "", err
+	}
+
+	id, err := randomString(8, hex.EncodeToString)
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := randomString(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return "", err
+	}
+
+	reset := &passwordReset{
+		ID:        id,
+		Hash:      hashSecret(secret),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(p.ResetTTL).Unix(),
+	}
+
+	err = data.WithTransaction(p.db, func(tx data.TxWrapper) error {
+		if _, err := tx.Exec(tx.Rebind(`DELETE FROM password_resets WHERE user_id = ?`), user.ID); err != nil {
+			return err
+		}
+
+		_, err := tx.NamedExec(`INSERT INTO password_resets (id, hash, user_id, expires_at)
+			VALUES (:id, :hash, :user_id, :expires_at)`, reset)
+
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return id + "." + secret, nil
+}
+
+// ResetPassword sets the password of the user the reset token was
+// created for. Each token can be used once.
+func (p *LocalProvider) ResetPassword(token, password string) error {
+	id, secret, ok := splitSecretToken(token)
+	if !ok {
+		return ErrInvalidResetToken
+	}
+
+	var userID string
+
+	err := data.WithTransaction(p.db, func(tx data.TxWrapper) error {
+		reset := new(passwordReset)
+		if err := tx.Get(reset, tx.Rebind(`SELECT id, hash, user_id, expires_at FROM password_resets WHERE id = ?`), id); err == sql.ErrNoRows {
+			return ErrInvalidResetToken
+		} else if err != nil {
+			return err
+		}
+
+		if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(reset.Hash)) != 1 || time.Now().Unix() >= reset.ExpiresAt {
+			return ErrInvalidResetToken
+		}
+
+		// Deleting the token first makes sure concurrent resets can't both use it.
+		if err := p.update(tx, `DELETE FROM password_resets WHERE id = ?`, id); err == ErrUserNotFound {
+			return ErrInvalidResetToken
+		} else if err != nil {
+			return err
+		}
+
+		userID = reset.UserID
+
+		return p.setPasswordHash(tx, userID, password)
+	})
+	if err != nil {
+		return err
+	}
+
+	return p.revokeTokens(userID)
+}
+
+// RoleList returns the user's roles.
+func (u *LocalUser) RoleList() []string {
+	return splitList(u.Roles)
+}
+
+func (p *LocalProvider) user(db data.DataContext, where string, arg interface{}) (*LocalUser, error) {
+	user := new(LocalUser)
+
+	err := db.Get(user, db.Rebind(`SELECT `+localUserColumns+` FROM local_users WHERE `+where), arg)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// checkUsernameFree returns ErrUserExists if a user has the username.
+func (p *LocalProvider) checkUsernameFree(username string) error {
+	if _, err := p.User(username); err == nil {
+		return ErrUserExists
+	} else if err != ErrUserNotFound {
+		return err
+	}
+
+	return nil
+}
+
+func (p *LocalProvider) setPasswordHash(db data.DataContext, userID, password string) error {
+	hash, err := p.Hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	return p.update(db, `UPDATE local_users SET password_hash = ?, updated_at = ? WHERE id = ?`, hash, time.Now().Unix(), userID)
+}
+
+// update executes the statement, returning ErrUserNotFound if no row changed.
+func (p *LocalProvider) update(db data.DataContext, query string, args ...interface{}) error {
+	result, err := db.Exec(db.Rebind(query), args...)
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (p *LocalProvider) revokeTokens(userID string) error {
+	if p.Revocations == nil {
+		return nil
+	}
+
+	return p.Revocations.RevokeUser(userID, time.Now())
+}
+
+func (p *LocalProvider) dummyPasswordHash() string {
+	p.dummyOnce.Do(func() {
+		p.dummyHash, _ = p.Hasher.Hash("")
+	})
+
+	return p.dummyHash
+}
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func newTestLocalProvider(t *testing.T) *LocalProvider {
+	t.Helper()
+
+	p := NewLocalProvider(newTestDB(t, LocalUserSchema, PasswordResetSchema), newTestIssuer(t))
+	p.Hasher = testArgon2idHasher
+
+	return p
+}
+
+func TestLocalProviderLogin(t *testing.T) {
+	p := newTestLocalProvider(t)
+
+	if _, err := p.CreateUser("bob", "secret", []string{"admin"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.CreateUser("bob", "other", nil); err != ErrUserExists {
+		t.Errorf("duplicate user: got %v, want %v", err, ErrUserExists)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		err      error
+	}{
+		{"valid", "bob", "secret", nil},
+		{"wrong password", "bob", "wrong", ErrInvalidLogin},
+		{"unknown user", "alice", "secret", ErrInvalidLogin},
+	}
+
+	for _, tt := range tests {
+		token, err := p.Login(tt.username, tt.password)
+		if err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+
+		if err == nil {
+			parsed, err := jwt.Parse(token.String(), p.Keyfunc)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if claims := parsed.Claims.(jwt.MapClaims); claims["username"] != "bob" {
+				t.Errorf("%s: got claims %v, want username bob", tt.name, claims)
+			}
+		}
+	}
+}
+
+func TestLocalProviderRehash(t *testing.T) {
+	p := newTestLocalProvider(t)
+
+	if _, err := p.CreateUser("bob", "secret", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	stronger := *testArgon2idHasher
+	stronger.Time++
+	p.Hasher = &stronger
+
+	if _, err := p.Login("bob", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := p.User("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Hasher.NeedsRehash(user.PasswordHash) {
+		t.Errorf("password not rehashed with the new parameters: %s", user.PasswordHash)
+	}
+
+	if _, err := p.Login("bob", "secret"); err != nil {
+		t.Errorf("login after rehash: %v", err)
+	}
+}
+
+func TestLocalProviderResetPassword(t *testing.T) {
+	p := newTestLocalProvider(t)
+
+	if _, err := p.CreateUser("bob", "secret", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := p.CreatePasswordReset("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.ResetPassword(token, "new secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.ResetPassword(token, "third secret"); err != ErrInvalidResetToken {
+		t.Errorf("reused reset token: got %v, want %v", err, ErrInvalidResetToken)
+	}
+
+	if _, err := p.Login("bob", "new secret"); err != nil {
+		t.Errorf("login with the reset password: %v", err)
+	}
+
+	p.ResetTTL = -time.Second
+
+	expired, err := p.CreatePasswordReset("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.ResetPassword(expired, "third secret"); err != ErrInvalidResetToken {
+		t.Errorf("expired reset token: got %v, want %v", err, ErrInvalidResetToken)
+	}
+}
+
+func TestLocalProviderCreateUserRace(t *testing.T) {
+	db := newTestDB(t, LocalUserSchema, PasswordResetSchema)
+	issuer := newTestIssuer(t)
+
+	racing := &racingDB{SqlxWrapper: db}
+	racing.race = func() {
+		other := NewLocalProvider(db, issuer)
+		other.Hasher = testArgon2idHasher
+
+		if _, err := other.CreateUser("bob", "secret", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := NewLocalProvider(racing, issuer)
+	p.Hasher = testArgon2idHasher
+
+	if _, err := p.CreateUser("bob", "other", nil); !errors.Is(err, ErrUserExists) {
+		t.Errorf("concurrently created user: got %v, want %v", err, ErrUserExists)
+	}
+}
@@ -0,0 +1,387 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultFailureWindow is how long failed logins are remembered.
+const DefaultFailureWindow = time.Hour
+
+// ErrLockedOut is returned by a ThrottledProvider instead of trying a login
+// for a username or client that failed too often. Errors returned for it
+// are *LockedOutError and wrap ErrLockedOut.
+var ErrLockedOut = errors.New("too many failed logins")
+
+var (
+	// DefaultUserLockoutPolicy applies to failures per username.
+	DefaultUserLockoutPolicy = LockoutPolicy{
+		FreeAttempts:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		LockoutAfter:    10,
+		LockoutDuration: 15 * time.Minute,
+	}
+
+	// DefaultIPLockoutPolicy applies to failures per client IP. It is more
+	// lenient, as many users can share an address.
+	DefaultIPLockoutPolicy = LockoutPolicy{
+		FreeAttempts:    20,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		LockoutAfter:    100,
+		LockoutDuration: 15 * time.Minute,
+	}
+)
+
+type (
+	// LockoutPolicy decides how long logins are refused after failures.
+	// After FreeAttempts failures every further attempt must wait BaseDelay,
+	// doubling with each failure up to MaxDelay. After LockoutAfter failures
+	// logins are refused for LockoutDuration.
+	LockoutPolicy struct {
+		FreeAttempts    int
+		BaseDelay       time.Duration
+		MaxDelay        time.Duration
+		LockoutAfter    int
+		LockoutDuration time.Duration
+	}
+
+	// LockedOutError is returned when a login is refused. Until is when
+	// the next attempt will be tried.
+	LockedOutError struct {
+		Until time.Time
+	}
+
+	// LockoutStore counts failed logins per key, e.g. a username or IP.
+	// Attempts in progress are reserved, so concurrent attempts see each
+	// other before any of them failed.
+	LockoutStore interface {
+		// Failures returns the number of failures of the key within the
+		// window plus its reserved attempts, and the time of the last of
+		// them.
+		Failures(key string, window time.Duration) (count int, last time.Time, err error)
+
+		// Reserve counts an attempt in progress and returns Failures'
+		// count including it. Once released, the attempt no longer affects
+		// Failures.
+		Reserve(key string, at time.Time, window time.Duration) (count int, err error)
+
+		// Release ends an attempt counted by Reserve.
+		Release(key string) error
+
+		// RecordFailure counts a failure at the given time and returns the
+		// number of failures within the window including it.
+		RecordFailure(key string, at time.Time, window time.Duration) (count int, err error)
+
+		// Reset forgets the failures of the key, but not its reserved attempts.
+		Reset(key string) error
+	}
+
+	// ThrottledProvider is a Provider that refuses logins for usernames
+	// and client IPs with too many recent failures. Only ErrInvalidLogin
+	// counts as a failure. A successful login resets the failures of the
+	// username, but not of the IP.
+	ThrottledProvider struct {
+		provider Provider
+		store    LockoutStore
+
+		UserPolicy LockoutPolicy
+		IPPolicy   LockoutPolicy
+
+		// FailureWindow is how long failures are remembered. It should be
+		// longer than the lockout durations.
+		FailureWindow time.Duration
+	}
+
+	memoryLockoutStore struct {
+		mu       sync.Mutex
+		failures map[string]lockoutEntry
+	}
+
+	lockoutEntry struct {
+		count      int
+		last       time.Time
+		reserved   int
+		reservedAt time.Time
+	}
+)
+
+// NewThrottledProvider wraps provider with the default policies. The store
+// should be shared by all replicas, e.g. NewSQLLockoutStore, for the limits
+// to hold across them.
+func NewThrottledProvider(provider Provider, store LockoutStore) *ThrottledProvider {
+	return &ThrottledProvider{
+		provider:      provider,
+		store:         store,
+		UserPolicy:    DefaultUserLockoutPolicy,
+		IPPolicy:      DefaultIPLockoutPolicy,
+		FailureWindow: DefaultFailureWindow,
+	}
+}
+
+// Login is LoginFrom without a client IP.
+func (t *ThrottledProvider) Login(username, password string) (Token, error) {
+	return t.LoginFrom("", username, password)
+}
+
+// LoginFrom tries the login unless the username or the client IP is
+// throttled, in which case a *LockedOutError is returned.
+func (t *ThrottledProvider) LoginFrom(ip, username, password string) (Token, error) {
+	now := time.Now()
+	keys := []string{"user:" + strings.ToLower(username)}
+
+	// Check the IP first, so attempts from a throttled IP never reserve
+	// the user's key.
+	if ip != "" {
+		if _, err := checkAttempt(t.store, "ip:"+ip, t.IPPolicy, t.FailureWindow, now); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := reserveAttempt(t.store, keys[0], t.UserPolicy, t.FailureWindow, now); err != nil {
+		return nil, err
+	}
+
+	if ip != "" {
+		if err := reserveAttempt(t.store, "ip:"+ip, t.IPPolicy, t.FailureWindow, now); err != nil {
+			if releaseErr := t.release(keys...); releaseErr != nil {
+				return nil, releaseErr
+			}
+
+			return nil, err
+		}
+
+		keys = append(keys, "ip:"+ip)
+	}
+
+	token, err := loginFrom(t.provider, ip, username, password)
+	if errors.Is(err, ErrInvalidLogin) {
+		for _, key := range keys {
+			if _, storeErr := t.store.RecordFailure(key, now, t.FailureWindow); storeErr != nil {
+				return nil, storeErr
+			}
+		}
+	}
+
+	if releaseErr := t.release(keys...); releaseErr != nil {
+		return nil, releaseErr
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.store.Reset(keys[0]); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// RequestSigningKeys is passed on to the wrapped provider.
+func (t *ThrottledProvider) RequestSigningKeys(name, token string) (*SigningKeys, error) {
+	return t.provider.RequestSigningKeys(name, token)
+}
+
+// reserveAttempt refuses the attempt if the key is throttled, and
+// otherwise reserves it in the store until it is released, so concurrent
+// attempts can't all pass the check before any of them failed.
+func reserveAttempt(store LockoutStore, key string, policy LockoutPolicy, window time.Duration, now time.Time) error {
+	count, err := checkAttempt(store, key, policy, window, now)
+	if err != nil {
+		return err
+	}
+
+	reserved, err := store.Reserve(key, now, window)
+	if err != nil {
+		return err
+	}
+
+	// Other attempts were reserved since the check. Refuse this one if
+	// they throttle it.
+	if until := policy.BlockedUntil(reserved-1, now); reserved > count+1 && until.After(now) {
+		if err := store.Release(key); err != nil {
+			return err
+		}
+
+		return &LockedOutError{Until: until}
+	}
+
+	return nil
+}
+
+// checkAttempt returns a *LockedOutError if the key is throttled, and
+// otherwise its count of failures and reserved attempts.
+func checkAttempt(store LockoutStore, key string, policy LockoutPolicy, window time.Duration, now time.Time) (int, error) {
+	count, last, err := store.Failures(key, window)
+	if err != nil {
+		return 0, err
+	}
+
+	if until := policy.BlockedUntil(count, last); until.After(now) {
+		return 0, &LockedOutError{Until: until}
+	}
+
+	return count, nil
+}
+
+func (t *ThrottledProvider) release(keys ...string) error {
+	for _, key := range keys {
+		if err := t.store.Release(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// BlockedUntil returns the time before which no login is tried after
+// count failures, the last of them at last.
+func (p LockoutPolicy) BlockedUntil(count int, last time.Time) time.Time {
+	if p.LockoutAfter > 0 && count >= p.LockoutAfter {
+		return last.Add(p.LockoutDuration)
+	}
+
+	if count < p.FreeAttempts || count == 0 {
+		return time.Time{}
+	}
+
+	delay := p.BaseDelay
+
+	for i := p.FreeAttempts; i < count && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	return last.Add(delay)
+}
+
+func (e *LockedOutError) Error() string {
+	return ErrLockedOut.Error() + ", retry after " + e.Until.Format(time.RFC3339)
+}
+
+func (e *LockedOutError) Unwrap() error {
+	return ErrLockedOut
+}
+
+// NewMemoryLockoutStore returns a LockoutStore that keeps failures in
+// memory. Failures are lost on restart and not shared between replicas.
+func NewMemoryLockoutStore() LockoutStore {
+	return &memoryLockoutStore{
+		failures: make(map[string]lockoutEntry),
+	}
+}
+
+func (m *memoryLockoutStore) Failures(key string, window time.Duration) (int, time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count, last := m.failures[key].within(time.Now().Add(-window))
+
+	return count, last, nil
+}
+
+func (m *memoryLockoutStore) Reserve(key string, at time.Time, window time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune(at.Add(-window))
+
+	entry := m.failures[key]
+	entry.reserved++
+	entry.reservedAt = at
+	m.failures[key] = entry
+
+	count, _ := entry.within(at.Add(-window))
+
+	return count, nil
+}
+
+func (m *memoryLockoutStore) Release(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.failures[key]
+	if !ok || entry.reserved == 0 {
+		return nil
+	}
+
+	entry.reserved--
+	m.failures[key] = entry
+
+	return nil
+}
+
+func (m *memoryLockoutStore) RecordFailure(key string, at time.Time, window time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune(at.Add(-window))
+
+	entry := m.failures[key]
+	if entry.last.Before(at.Add(-window)) {
+		entry.count = 0
+	}
+
+	entry.count++
+	entry.last = at
+	m.failures[key] = entry
+
+	return entry.count, nil
+}
+
+func (m *memoryLockoutStore) Reset(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.failures[key]
+	if !ok {
+		return nil
+	}
+
+	if entry.reserved == 0 {
+		delete(m.failures, key)
+	} else {
+		m.failures[key] = lockoutEntry{reserved: entry.reserved, reservedAt: entry.reservedAt}
+	}
+
+	return nil
+}
+
+// prune forgets entries without failures or reservations since stale.
+func (m *memoryLockoutStore) prune(stale time.Time) {
+	for k, entry := range m.failures {
+		if entry.last.Before(stale) && (entry.reserved == 0 || entry.reservedAt.Before(stale)) {
+			delete(m.failures, k)
+		}
+	}
+}
+
+// within returns the failures since stale plus the reserved attempts, and
+// the time of the last of them. A released attempt no longer counts, so
+// the time falls back to the last failure.
+func (e lockoutEntry) within(stale time.Time) (int, time.Time) {
+	var count int
+
+	var last time.Time
+
+	if !e.last.Before(stale) {
+		count, last = e.count, e.last
+	}
+
+	if e.reserved > 0 && !e.reservedAt.Before(stale) {
+		count += e.reserved
+
+		if e.reservedAt.After(last) {
+			last = e.reservedAt
+		}
+	}
+
+	return count, last
+}
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/zjeremiah/stdlib/data"
+)
+
+// LockoutSchema creates the table used by the SQL LockoutStore. Times are
+// stored as unix milliseconds, as backoff delays can be shorter than a
+// second. reserved counts attempts in progress, the last of them made at
+// reserved_at; they don't move last_failure.
+const LockoutSchema = `
+CREATE TABLE IF NOT EXISTS login_failures (
+	lockout_key  VARCHAR(255) PRIMARY KEY,
+	failures     INTEGER NOT NULL,
+	last_failure BIGINT NOT NULL,
+	reserved     INTEGER NOT NULL,
+	reserved_at  BIGINT NOT NULL
+);`
+
+type (
+	sqlLockoutStore struct {
+		db data.SqlxWrapper
+	}
+
+	lockoutRow struct {
+		Failures    int   `db:"failures"`
+		LastFailure int64 `db:"last_failure"`
+		Reserved    int   `db:"reserved"`
+		ReservedAt  int64 `db:"reserved_at"`
+	}
+)
+
+// NewSQLLockoutStore returns a LockoutStore backed by the table in
+// LockoutSchema, so failures are shared between replicas.
+func NewSQLLockoutStore(db data.SqlxWrapper) LockoutStore {
+	return &sqlLockoutStore{db: db}
+}
+
+func (s *sqlLockoutStore) Failures(key string, window time.Duration) (int, time.Time, error) {
+	return s.count(key, time.Now().Add(-window))
+}
+
+func (s *sqlLockoutStore) Reserve(key string, at time.Time, window time.Duration) (int, error) {
+	if err := s.prune(at.Add(-window)); err != nil {
+		return 0, err
+	}
+
+	err := upsert(s.db,
+		`UPDATE login_failures SET reserved = reserved + 1, reserved_at = ? WHERE lockout_key = ?`, []interface{}{at.UnixMilli(), key},
+		`INSERT INTO login_failures (lockout_key, failures, last_failure, reserved, reserved_at) VALUES (?, 0, 0, 1, ?)`, key, at.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+
+	count, _, err := s.count(key, at.Add(-window))
+
+	return count, err
+}
+
+func (s *sqlLockoutStore) Release(key string) error {
+	_, err := s.db.Exec(s.db.Rebind(`UPDATE login_failures SET reserved = reserved - 1 WHERE lockout_key = ? AND reserved > 0`), key)
+	return err
+}
+
+func (s *sqlLockoutStore) RecordFailure(key string, at time.Time, window time.Duration) (int, error) {
+	stale := at.Add(-window)
+
+	if err := s.prune(stale); err != nil {
+		return 0, err
+	}
+
+	err := upsert(s.db,
+		`UPDATE login_failures SET failures = CASE WHEN last_failure < ? THEN 1 ELSE failures + 1 END, last_failure = ? WHERE lockout_key = ?`,
+		[]interface{}{stale.UnixMilli(), at.UnixMilli(), key},
+		`INSERT INTO login_failures (lockout_key, failures, last_failure, reserved, reserved_at) VALUES (?, 1, ?, 0, 0)`, key, at.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	err = s.db.Get(&count, s.db.Rebind(`SELECT failures FROM login_failures WHERE lockout_key = ?`), key)
+
+	return count, err
+}
+
+func (s *sqlLockoutStore) Reset(key string) error {
+	_, err := s.db.Exec(s.db.Rebind(`UPDATE login_failures SET failures = 0, last_failure = 0 WHERE lockout_key = ?`), key)
+	return err
+}
+
+// prune deletes rows without failures or reservations since stale.
+func (s *sqlLockoutStore) prune(stale time.Time) error {
+	_, err := s.db.Exec(s.db.Rebind(`DELETE FROM login_failures WHERE last_failure < ? AND (reserved = 0 OR reserved_at < ?)`),
+		stale.UnixMilli(), stale.UnixMilli())
+	return err
+}
+
+// count returns the failures of the key since stale plus its reserved
+// attempts, and the time of the last failure.
+func (s *sqlLockoutStore) count(key string, stale time.Time) (int, time.Time, error) {
+	var row lockoutRow
+
+	err := s.db.Get(&row, s.db.Rebind(`SELECT failures, last_failure, reserved, reserved_at FROM login_failures WHERE lockout_key = ?`), key)
+	if err == sql.ErrNoRows {
+		return 0, time.Time{}, nil
+	} else if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	entry := lockoutEntry{
+		count:      row.Failures,
+		last:       time.UnixMilli(row.LastFailure),
+		reserved:   row.Reserved,
+		reservedAt: time.UnixMilli(row.ReservedAt),
+	}
+
+	count, last := entry.within(stale)
+
+	return count, last, nil
+}
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type slowRejectingProvider struct {
+	calls int64
+}
+
+func (p *slowRejectingProvider) Login(username, password string) (Token, error) {
+	atomic.AddInt64(&p.calls, 1)
+	time.Sleep(10 * time.Millisecond)
+
+	return nil, ErrInvalidLogin
+}
+
+func (p *slowRejectingProvider) RequestSigningKeys(name, token string) (*SigningKeys, error) {
+	return nil, ErrSigningKeysUnsupported
+}
+
+func TestThrottledProviderConcurrentAttempts(t *testing.T) {
+	provider := new(slowRejectingProvider)
+	store := NewMemoryLockoutStore()
+
+	throttled := NewThrottledProvider(provider, store)
+	throttled.UserPolicy = LockoutPolicy{
+		FreeAttempts: 1,
+		BaseDelay:    time.Hour,
+		MaxDelay:     time.Hour,
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := throttled.Login("bob", "wrong")
+			if !errors.Is(err, ErrInvalidLogin) && !errors.Is(err, ErrLockedOut) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if n := atomic.LoadInt64(&provider.calls); n != 1 {
+		t.Errorf("got %d attempts past the limit, want 1", n)
+	}
+
+	count, _, err := store.Failures("user:bob", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 1 {
+		t.Errorf("got %d recorded failures, want 1", count)
+	}
+}
+
+func TestThrottledProviderRefusalsKeepLastFailure(t *testing.T) {
+	stores := []struct {
+		name  string
+		store LockoutStore
+	}{
+		{"memory", NewMemoryLockoutStore()},
+		{"sql", NewSQLLockoutStore(newTestDB(t, LockoutSchema))},
+	}
+
+	failedAt := time.Now().Add(-30 * time.Minute).Truncate(time.Millisecond)
+
+	for _, tt := range stores {
+		if _, err := tt.store.RecordFailure("user:bob", failedAt, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := tt.store.RecordFailure("ip:10.0.0.2", failedAt, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 5; i++ {
+			if _, err := tt.store.RecordFailure("ip:10.0.0.1", time.Now(), time.Hour); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		throttled := NewThrottledProvider(NewFakeProvider([]byte("key")), tt.store)
+		throttled.IPPolicy = LockoutPolicy{LockoutAfter: 5, LockoutDuration: time.Hour}
+
+		// Attempts from the locked out IP are refused without touching
+		// the user's failures.
+		for i := 0; i < 3; i++ {
+			if _, err := throttled.LoginFrom("10.0.0.1", "bob", "password"); !errors.Is(err, ErrLockedOut) {
+				t.Fatalf("%s: login from locked out ip: got %v, want %v", tt.name, err, ErrLockedOut)
+			}
+		}
+
+		if count, last, err := tt.store.Failures("user:bob", time.Hour); err != nil {
+			t.Fatal(err)
+		} else if count != 1 || !last.Equal(failedAt) {
+			t.Errorf("%s: user failures: got %d at %s, want 1 at %s", tt.name, count, last, failedAt)
+		}
+
+		// A successful login releases the IP's reservation without
+		// touching its failures.
+		if _, err := throttled.LoginFrom("10.0.0.2", "alice", "password"); err != nil {
+			t.Fatalf("%s: login: %v", tt.name, err)
+		}
+
+		if count, last, err := tt.store.Failures("ip:10.0.0.2", time.Hour); err != nil {
+			t.Fatal(err)
+		} else if count != 1 || !last.Equal(failedAt) {
+			t.Errorf("%s: ip failures: got %d at %s, want 1 at %s", tt.name, count, last, failedAt)
+		}
+	}
+}
@@ -0,0 +1,424 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultMFAChallengeTTL is how long an MFA challenge can be answered.
+const DefaultMFAChallengeTTL = 5 * time.Minute
+
+var (
+	// ErrMFARequired is returned by a TOTPProvider's Login when the user
+	// must answer an MFA challenge. Errors returned for it are
+	// *MFAChallengeError and wrap ErrMFARequired.
+	ErrMFARequired = errors.New("multi-factor authentication required")
+
+	// ErrInvalidMFACode is returned for wrong or already used TOTP codes.
+	ErrInvalidMFACode = errors.New("invalid mfa code")
+
+	// ErrInvalidChallenge is returned for forged or expired MFA challenges.
+	ErrInvalidChallenge = errors.New("invalid or expired mfa challenge")
+
+	// ErrNotEnrolled is returned when confirming an enrollment that was never started.
+	ErrNotEnrolled = errors.New("user is not enrolled in mfa")
+)
+
+type (
+	// MFAProvider is a Provider whose Login may require a second factor.
+	// Login then fails with an *MFAChallengeError, and VerifyMFA returns
+	// the token for the challenge and a valid code.
+	MFAProvider interface {
+		Provider
+		VerifyMFA(challenge, code string) (Token, error)
+	}
+
+	// MFAChallengeError is returned by Login when the user must answer
+	// the challenge with VerifyMFA before ExpiresAt.
+	MFAChallengeError struct {
+		Challenge string
+		ExpiresAt time.Time
+	}
+
+	// MFAStore keeps the users' TOTP secrets.
+	MFAStore interface {
+		// Secret returns the user's confirmed secret and the secret of an
+		// enrollment awaiting confirmation. Either is empty if there is none.
+		Secret(username string) (secret, pending string, err error)
+
+		// SavePendingSecret stores a secret awaiting confirmation for the
+		// user, replacing any pending one. A confirmed secret stays active.
+		SavePendingSecret(username, secret string) error
+
+		// Confirm makes the pending secret the user's secret, if it still
+		// is the given one. It returns ErrNotEnrolled otherwise.
+		Confirm(username, pending string) error
+
+		// Delete removes the user's secret.
+		Delete(username string) error
+
+		// UseStep records that a code of the time step was used. It
+		// returns false if a code of that or a later step was used before.
+		UseStep(username string, step int64) (bool, error)
+	}
+
+	// TOTPProvider is a Provider that requires users with a confirmed
+	// TOTP enrollment to answer an MFA challenge after their password.
+	// Challenges are sealed with the challenge key and carry the pending
+	// token, so replicas sharing the key can verify each other's.
+	//
+	// Wrap it around a ThrottledProvider or AuditedProvider rather than
+	// the other way round, as they don't pass VerifyMFA on.
+	TOTPProvider struct {
+		provider Provider
+		store    MFAStore
+		aead     cipher.AEAD
+
+		// IssuerName is shown in authenticator apps for enrolled secrets.
+		IssuerName string
+
+		// ChallengeTTL is how long a challenge can be answered.
+		ChallengeTTL time.Duration
+
+		// Lockout throttles wrong codes per user with LockoutPolicy. It
+		// must not be nil; NewTOTPProvider sets a memory store, which
+		// should be replaced by a shared one, e.g. NewSQLLockoutStore,
+		// when running replicas.
+		Lockout       LockoutStore
+		LockoutPolicy LockoutPolicy
+
+		// Audit records MFA successes and failures. It may be nil.
+		Audit *Auditor
+	}
+
+	mfaChallenge struct {
+		Username  string `json:"u"`
+		Token     string `json:"t"`
+		ExpiresAt int64  `json:"e"`
+	}
+
+	memoryMFAStore struct {
+		mu      sync.Mutex
+		secrets map[string]*memoryMFASecret
+	}
+
+	memoryMFASecret struct {
+		secret   string
+		pending  string
+		lastStep int64
+	}
+)
+
+// NewTOTPProvider wraps provider with a TOTP second factor. Challenges
+// are sealed with a key derived from challengeKey; if it is empty, a
+// random key is used and challenges only verify on this process.
+func NewTOTPProvider(provider Provider, store MFAStore, challengeKey []byte) (*TOTPProvider, error) {
+	if len(challengeKey) == 0 {
+		challengeKey = make([]byte, 32)
+		if _, err := rand.Read(challengeKey); err != nil {
+			return nil, err
+		}
+	}
+
+	key := sha256.Sum256(append([]byte("stdlib mfa challenge:"), challengeKey...))
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TOTPProvider{
+		provider:      provider,
+		store:         store,
+		aead:          aead,
+		ChallengeTTL:  DefaultMFAChallengeTTL,
+		Lockout:       NewMemoryLockoutStore(),
+		LockoutPolicy: DefaultUserLockoutPolicy,
+	}, nil
+}
+
+// Login is LoginFrom without a client IP.
+func (p *TOTPProvider) Login(username, password string) (Token, error) {
+	return p.LoginFrom("", username, password)
+}
+
+// LoginFrom logs in with the wrapped provider. Users with a confirmed
+// enrollment get an *MFAChallengeError instead of the token.
+func (p *TOTPProvider) LoginFrom(ip, username, password string) (Token, error) {
+	token, err := loginFrom(p.provider, ip, username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, _, err := p.store.Secret(username)
+	if err != nil {
+		return nil, err
+	}
+
+	if secret == "" {
+		return token, nil
+	}
+
+	expiresAt := time.Now().Add(p.ChallengeTTL)
+
+	challenge, err := p.seal(&mfaChallenge{
+		Username:  username,
+		Token:     token.String(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, &MFAChallengeError{Challenge: challenge, ExpiresAt: expiresAt}
+}
+
+// VerifyMFA returns the token of the challenge if code is a current TOTP
+// code of the user that was not used before.
+func (p *TOTPProvider) VerifyMFA(challenge, code string) (Token, error) {
+	c, err := p.open(challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := p.verifyCode(c.Username, code, false); err != nil {
+		return nil, err
+	}
+
+	return []byte(c.Token), nil
+}
+
+// RequestSigningKeys is passed on to the wrapped provider.
+func (p *TOTPProvider) RequestSigningKeys(name, token string) (*SigningKeys, error) {
+	return p.provider.RequestSigningKeys(name, token)
+}
+
+// Enroll generates a new secret for the user and returns it with its
+// provisioning URI. It is only used once ConfirmEnrollment succeeds; until
+// then logins keep requiring the user's current secret, if any.
+func (p *TOTPProvider) Enroll(username string) (secret, uri string, err error) {
+	secret, err = GenerateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := p.store.SavePendingSecret(username, secret); err != nil {
+		return "", "", err
+	}
+
+	return secret, TOTPProvisioningURI(p.IssuerName, username, secret), nil
+}
+
+// ConfirmEnrollment checks a code of the pending secret from the user's
+// authenticator and then requires it for the user's logins.
+func (p *TOTPProvider) ConfirmEnrollment(username, code string) error {
+	secret, err := p.verifyCode(username, code, true)
+	if err != nil {
+		return err
+	}
+
+	return p.store.Confirm(username, secret)
+}
+
+// Unenroll removes the user's secret, so logins no longer require MFA.
+func (p *TOTPProvider) Unenroll(username string) error {
+	return p.store.Delete(username)
+}
+
+// verifyCode checks the code against the user's confirmed or pending
+// secret and returns that secret. The attempt is reserved in the lockout
+// store first, so concurrent wrong codes can't pass the limit.
+func (p *TOTPProvider) verifyCode(username, code string, pending bool) (string, error) {
+	now := time.Now()
+	key := mfaLockoutKey(username)
+
+	if err := reserveAttempt(p.Lockout, key, p.LockoutPolicy, DefaultFailureWindow, now); err != nil {
+		return "", err
+	}
+
+	secret, err := p.checkCode(username, code, pending, now)
+	if errors.Is(err, ErrInvalidMFACode) {
+		if _, storeErr := p.Lockout.RecordFailure(key, now, DefaultFailureWindow); storeErr != nil {
+			return "", storeErr
+		}
+	}
+
+	if releaseErr := p.Lockout.Release(key); releaseErr != nil {
+		return "", releaseErr
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := p.Lockout.Reset(key); err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+func (p *TOTPProvider) checkCode(username, code string, pending bool, now time.Time) (string, error) {
+	secret, pendingSecret, err := p.store.Secret(username)
+	if err != nil {
+		return "", err
+	}
+
+	if pending {
+		secret = pendingSecret
+	}
+
+	if secret == "" {
+		return "", ErrNotEnrolled
+	}
+
+	step, ok := ValidateTOTP(secret, code, now)
+	if ok {
+		ok, err = p.store.UseStep(username, step)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if !ok {
+		p.Audit.Record(AuditEvent{Type: EventMFAFailure, Reason: ReasonInvalidCode, Username: username})
+		return "", ErrInvalidMFACode
+	}
+
+	p.Audit.Record(AuditEvent{Type: EventMFASuccess, Username: username})
+
+	return secret, nil
+}
+
+func (p *TOTPProvider) seal(c *mfaChallenge) (string, error) {
+	plain, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, p.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(p.aead.Seal(nonce, nonce, plain, nil)), nil
+}
+
+func (p *TOTPProvider) open(challenge string) (*mfaChallenge, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(challenge)
+	if err != nil || len(sealed) < p.aead.NonceSize() {
+		return nil, ErrInvalidChallenge
+	}
+
+	plain, err := p.aead.Open(nil, sealed[:p.aead.NonceSize()], sealed[p.aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrInvalidChallenge
+	}
+
+	c := new(mfaChallenge)
+	if err := json.Unmarshal(plain, c); err != nil {
+		return nil, ErrInvalidChallenge
+	}
+
+	if time.Now().Unix() > c.ExpiresAt {
+		return nil, ErrInvalidChallenge
+	}
+
+	return c, nil
+}
+
+func mfaLockoutKey(username string) string {
+	return "mfa:" + username
+}
+
+func (e *MFAChallengeError) Error() string {
+	return ErrMFARequired.Error()
+}
+
+func (e *MFAChallengeError) Unwrap() error {
+	return ErrMFARequired
+}
+
+// NewMemoryMFAStore returns an MFAStore that keeps secrets in memory.
+// Secrets are lost on restart and not shared between replicas.
+func NewMemoryMFAStore() MFAStore {
+	return &memoryMFAStore{
+		secrets: make(map[string]*memoryMFASecret),
+	}
+}
+
+func (m *memoryMFAStore) Secret(username string) (string, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.secrets[username]
+	if !ok {
+		return "", "", nil
+	}
+
+	return s.secret, s.pending, nil
+}
+
+func (m *memoryMFAStore) SavePendingSecret(username, secret string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.secrets[username]
+	if !ok {
+		s = new(memoryMFASecret)
+		m.secrets[username] = s
+	}
+
+	s.pending = secret
+
+	return nil
+}
+
+func (m *memoryMFAStore) Confirm(username, pending string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.secrets[username]
+	if !ok || s.pending == "" || s.pending != pending {
+		return ErrNotEnrolled
+	}
+
+	s.secret, s.pending = s.pending, ""
+
+	return nil
+}
+
+func (m *memoryMFAStore) Delete(username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.secrets, username)
+
+	return nil
+}
+
+func (m *memoryMFAStore) UseStep(username string, step int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.secrets[username]
+	if !ok || step <= s.lastStep {
+		return false, nil
+	}
+
+	s.lastStep = step
+
+	return true, nil
+}
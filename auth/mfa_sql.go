@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/zjeremiah/stdlib/data"
+)
+
+// MFASchema creates the table used by the SQL MFAStore. secret is the
+// confirmed secret and pending_secret the one awaiting confirmation, each
+// empty if there is none. confirmed_at is the unix time secret was last
+// confirmed. last_step is the time step of the last code used, so codes
+// can't be replayed.
+const MFASchema = `
+CREATE TABLE IF NOT EXISTS mfa_secrets (
+	username       VARCHAR(255) PRIMARY KEY,
+	secret         VARCHAR(255) NOT NULL,
+	pending_secret VARCHAR(255) NOT NULL,
+	confirmed_at   BIGINT NOT NULL,
+	last_step      BIGINT NOT NULL
+);`
+
+type sqlMFAStore struct {
+	db data.SqlxWrapper
+}
+
+// NewSQLMFAStore returns an MFAStore backed by the table in MFASchema.
+// Keep the database access restricted, as the secrets are stored as is.
+func NewSQLMFAStore(db data.SqlxWrapper) MFAStore {
+	return &sqlMFAStore{db: db}
+}
+
+func (s *sqlMFAStore) Secret(username string) (string, string, error) {
+	var row struct {
+		Secret        string `db:"secret"`
+		PendingSecret string `db:"pending_secret"`
+	}
+
+	err := s.db.Get(&row, s.db.Rebind(`SELECT secret, pending_secret FROM mfa_secrets WHERE username = ?`), username)
+	if err == sql.ErrNoRows {
+		return "", "", nil
+	} else if err != nil {
+		return "", "", err
+	}
+
+	return row.Secret, row.PendingSecret, nil
+}
+
+func (s *sqlMFAStore) SavePendingSecret(username, secret string) error {
+	return upsert(s.db,
+		`UPDATE mfa_secrets SET pending_secret = ? WHERE username = ?`, []interface{}{secret, username},
+		`INSERT INTO mfa_secrets (username, secret, pending_secret, confirmed_at, last_step) VALUES (?, '', ?, 0, 0)`, username, secret)
+}
+
+func (s *sqlMFAStore) Confirm(username, pending string) error {
+	if pending == "" {
+		return ErrNotEnrolled
+	}
+
+	result, err := s.db.Exec(s.db.Rebind(`UPDATE mfa_secrets SET secret = pending_secret, pending_secret = '', confirmed_at = ? WHERE username = ? AND pending_secret = ?`),
+		time.Now().Unix(), username, pending)
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotEnrolled
+	}
+
+	return nil
+}
+
+func (s *sqlMFAStore) Delete(username string) error {
+	_, err := s.db.Exec(s.db.Rebind(`DELETE FROM mfa_secrets WHERE username = ?`), username)
+	return err
+}
+
+func (s *sqlMFAStore) UseStep(username string, step int64) (bool, error) {
+	result, err := s.db.Exec(s.db.Rebind(`UPDATE mfa_secrets SET last_step = ? WHERE username = ? AND last_step < ?`), step, username, step)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+
+	return n > 0, err
+}
@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTOTPProviderReenrollment(t *testing.T) {
+	// Codes are generated for steps around now; don't straddle a step.
+	if left := TOTPPeriod - time.Duration(time.Now().UnixNano())%TOTPPeriod; left < 2*time.Second {
+		time.Sleep(left)
+	}
+
+	now := time.Now()
+	store := NewMemoryMFAStore()
+
+	p, err := NewTOTPProvider(NewFakeProvider([]byte("key")), store, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := func(secret string, offset time.Duration) string {
+		c, err := TOTPCode(secret, now.Add(offset))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return c
+	}
+
+	challenge := func() string {
+		var mfaErr *MFAChallengeError
+		if _, err := p.Login("bob", "password"); !errors.As(err, &mfaErr) {
+			t.Fatalf("login without mfa challenge: %v", err)
+		}
+
+		return mfaErr.Challenge
+	}
+
+	first, _, err := p.Enroll("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.Login("bob", "password"); err != nil {
+		t.Fatalf("unconfirmed enrollment required mfa: %v", err)
+	}
+
+	if err := p.ConfirmEnrollment("bob", code(first, -TOTPPeriod)); err != nil {
+		t.Fatal(err)
+	}
+
+	second, _, err := p.Enroll("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.VerifyMFA(challenge(), code(second, 0)); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("pending secret accepted for login: %v", err)
+	}
+
+	c := challenge()
+
+	if _, err := p.VerifyMFA(c, code(first, 0)); err != nil {
+		t.Fatalf("confirmed secret rejected during re-enrollment: %v", err)
+	}
+
+	if _, err := p.VerifyMFA(c, code(first, 0)); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("replayed code accepted: %v", err)
+	}
+
+	if err := p.ConfirmEnrollment("bob", code(second, TOTPPeriod)); err != nil {
+		t.Fatal(err)
+	}
+
+	secret, pending, err := store.Secret("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if secret != second || pending != "" {
+		t.Errorf("got secret %q and pending %q after confirmation, want %q and none", secret, pending, second)
+	}
+}
+
+func TestTOTPProviderConcurrentWrongCodes(t *testing.T) {
+	p, err := NewTOTPProvider(NewFakeProvider([]byte("key")), NewMemoryMFAStore(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.LockoutPolicy = LockoutPolicy{LockoutAfter: 3, LockoutDuration: time.Hour}
+
+	secret, _, err := p.Enroll("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := TOTPCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.ConfirmEnrollment("bob", code); err != nil {
+		t.Fatal(err)
+	}
+
+	var mfaErr *MFAChallengeError
+	if _, err := p.Login("bob", "password"); !errors.As(err, &mfaErr) {
+		t.Fatalf("login without mfa challenge: %v", err)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		invalid int64
+		locked  int64
+	)
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := p.VerifyMFA(mfaErr.Challenge, "wrong")
+
+			var lockedErr *LockedOutError
+
+			switch {
+			case errors.Is(err, ErrInvalidMFACode):
+				atomic.AddInt64(&invalid, 1)
+			case errors.As(err, &lockedErr):
+				atomic.AddInt64(&locked, 1)
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if invalid > 3 || locked == 0 {
+		t.Errorf("got %d codes checked and %d locked out, want at most 3 checked", invalid, locked)
+	}
+
+	code, err = TOTPCode(secret, time.Now().Add(TOTPPeriod))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lockedErr *LockedOutError
+	if _, err := p.VerifyMFA(mfaErr.Challenge, code); !errors.As(err, &lockedErr) {
+		t.Errorf("valid code after lockout: got %v, want a *LockedOutError", err)
+	}
+}
+
+func TestSQLMFAStoreSavePendingSecretRace(t *testing.T) {
+	db := newTestDB(t, MFASchema)
+
+	racing := &racingDB{SqlxWrapper: db, race: func() {
+		if err := NewSQLMFAStore(db).SavePendingSecret("bob", "first"); err != nil {
+			t.Fatal(err)
+		}
+	}}
+
+	store := NewSQLMFAStore(racing)
+
+	if err := store.SavePendingSecret("bob", "second"); err != nil {
+		t.Fatalf("concurrent enrollment failed: %v", err)
+	}
+
+	if _, pending, err := store.Secret("bob"); err != nil {
+		t.Fatal(err)
+	} else if pending != "second" {
+		t.Errorf("got pending secret %q, want %q", pending, "second")
+	}
+}
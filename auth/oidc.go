@@ -0,0 +1,251 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/zjeremiah/stdlib/xhttp"
+)
+
+// OIDCDiscoveryPath is where an OpenID Connect issuer publishes its configuration.
+const OIDCDiscoveryPath = "/.well-known/openid-configuration"
+
+var (
+	// ErrSigningKeysUnsupported is returned by providers that don't hand
+	// out SigningKeys. Use their Keyfunc to verify tokens instead.
+	ErrSigningKeysUnsupported = errors.New("provider does not hand out signing keys")
+
+	// ErrInvalidIDToken is returned when an ID token fails validation.
+	ErrInvalidIDToken = errors.New("invalid id token")
+)
+
+type (
+	// KeyfuncProvider is a Provider that verifies tokens with keys of its
+	// own, e.g. from a JWKS, instead of SigningKeys. api.SetupAuth uses
+	// Keyfunc when given such a provider.
+	KeyfuncProvider interface {
+		Provider
+		Keyfunc(t *jwt.Token) (interface{}, error)
+	}
+
+	// OIDCDiscovery is the part of an OpenID Connect discovery document
+	// this package uses.
+	OIDCDiscovery struct {
+		Issuer                string   `json:"issuer"`
+		AuthorizationEndpoint string   `json:"authorization_endpoint"`
+		TokenEndpoint         string   `json:"token_endpoint"`
+		UserinfoEndpoint      string   `json:"userinfo_endpoint"`
+		JWKSURI               string   `json:"jwks_uri"`
+		GrantTypesSupported   []string `json:"grant_types_supported"`
+		IDTokenSigningAlgs    []string `json:"id_token_signing_alg_values_supported"`
+	}
+
+	// OIDCProvider is a Provider backed by an OAuth2 / OpenID Connect
+	// issuer. Login uses the password grant, or the client credentials
+	// grant when called with an empty username, and returns the ID token
+	// if the issuer sent one, the access token otherwise.
+	OIDCProvider struct {
+		clientID     string
+		clientSecret string
+		client       xhttp.Client
+		discovery    *OIDCDiscovery
+		keys         *JWKSProvider
+
+		// Scopes are requested with every grant. "openid" is needed to
+		// get an ID token back from the password grant.
+		Scopes []string
+	}
+
+	oidcTokenResp struct {
+		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+)
+
+// NewOIDCProvider discovers the issuer's configuration and returns a
+// Provider that logs in against its token endpoint with the given client.
+func NewOIDCProvider(issuer, clientID, clientSecret string) (*OIDCProvider, error) {
+	return NewOIDCProviderWithClient(issuer, clientID, clientSecret, xhttp.NewDefaultClient())
+}
+
+// NewOIDCProviderWithClient is NewOIDCProvider using the given http client.
+func NewOIDCProviderWithClient(issuer, clientID, clientSecret string, client xhttp.Client) (*OIDCProvider, error) {
+	discovery, err := DiscoverOIDC(issuer, client)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := NewJWKSProviderWithClient(discovery.JWKSURI, client)
+	keys.Algorithms = discovery.IDTokenSigningAlgs
+
+	if err := keys.Refresh(); err != nil {
+		return nil, err
+	}
+
+	return &OIDCProvider{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		client:       client,
+		discovery:    discovery,
+		keys:         keys,
+		Scopes:       []string{"openid"},
+	}, nil
+}
+
+// DiscoverOIDC fetches the discovery document of the issuer and checks
+// that it describes that issuer.
+func DiscoverOIDC(issuer string, client xhttp.Client) (*OIDCDiscovery, error) {
+	issuer = strings.TrimSuffix(issuer, "/")
+
+	resp, err := client.Get(issuer + OIDCDiscoveryPath)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not discover oidc issuer: %s", resp.Status)
+	}
+
+	discovery := new(OIDCDiscovery)
+	if err := json.Unmarshal(b, discovery); err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSuffix(discovery.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("oidc discovery issuer %q does not match %q", discovery.Issuer, issuer)
+	}
+
+	if discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("oidc discovery document lacks token_endpoint or jwks_uri")
+	}
+
+	return discovery, nil
+}
+
+// Discovery returns the issuer's discovery document.
+func (o *OIDCProvider) Discovery() *OIDCDiscovery {
+	return o.discovery
+}
+
+// ClientID returns the id of the client the provider logs in with.
+func (o *OIDCProvider) ClientID() string {
+	return o.clientID
+}
+
+// Login runs the password grant for the user, or the client credentials
+// grant if username is empty.
+func (o *OIDCProvider) Login(username, password string) (Token, error) {
+	form := url.Values{}
+
+	if username == "" {
+		form.Set("grant_type", "client_credentials")
+	} else {
+		form.Set("grant_type", "password")
+		form.Set("username", username)
+		form.Set("password", password)
+	}
+
+	if len(o.Scopes) > 0 {
+		form.Set("scope", strings.Join(o.Scopes, " "))
+	}
+
+	req, err := http.NewRequest("POST", o.discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(o.clientID), url.QueryEscape(o.clientSecret))
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized {
+		return nil, ErrInvalidLogin
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc token request failed: %s", resp.Status)
+	}
+
+	tokenResp := new(oidcTokenResp)
+	if err := json.Unmarshal(b, tokenResp); err != nil {
+		return nil, err
+	}
+
+	if tokenResp.IDToken != "" {
+		if _, err := o.ValidateIDToken(tokenResp.IDToken); err != nil {
+			return nil, err
+		}
+
+		return []byte(tokenResp.IDToken), nil
+	}
+
+	if tokenResp.AccessToken == "" {
+		return nil, errors.New("oidc token response has no token")
+	}
+
+	return []byte(tokenResp.AccessToken), nil
+}
+
+// RequestSigningKeys is not supported by OpenID Connect issuers; they
+// publish a JWKS instead. Use Keyfunc.
+func (o *OIDCProvider) RequestSigningKeys(name, token string) (*SigningKeys, error) {
+	return nil, ErrSigningKeysUnsupported
+}
+
+// Keyfunc resolves the issuer's key for a token from its JWKS.
+func (o *OIDCProvider) Keyfunc(t *jwt.Token) (interface{}, error) {
+	return o.keys.Keyfunc(t)
+}
+
+// ValidateIDToken verifies the ID token's signature against the issuer's
+// keys and checks that it was issued by the issuer for this client and
+// has not expired.
+func (o *OIDCProvider) ValidateIDToken(raw string) (*jwt.Token, error) {
+	token, err := jwt.Parse(raw, o.keys.Keyfunc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidIDToken, err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidIDToken
+	}
+
+	if !claims.VerifyIssuer(o.discovery.Issuer, true) {
+		return nil, fmt.Errorf("%w: wrong issuer", ErrInvalidIDToken)
+	}
+
+	if !claims.VerifyAudience(o.clientID, true) {
+		return nil, fmt.Errorf("%w: wrong audience", ErrInvalidIDToken)
+	}
+
+	if _, ok := claims["exp"]; !ok {
+		return nil, fmt.Errorf("%w: missing exp", ErrInvalidIDToken)
+	}
+
+	return token, nil
+}
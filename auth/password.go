@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrUnknownPasswordHash is returned for password hashes of an unsupported format.
+var ErrUnknownPasswordHash = errors.New("unknown password hash format")
+
+var (
+	// DefaultArgon2idHasher hashes passwords with argon2id using the
+	// parameters recommended by RFC 9106 for memory constrained hosts.
+	DefaultArgon2idHasher = &Argon2idHasher{Time: 3, Memory: 64 * 1024, Threads: 4, SaltLength: 16, KeyLength: 32}
+
+	// DefaultBcryptHasher hashes passwords with bcrypt's default cost.
+	DefaultBcryptHasher = &BcryptHasher{Cost: bcrypt.DefaultCost}
+)
+
+type (
+	// PasswordHasher hashes passwords. VerifyPassword checks passwords
+	// against the hashes of every PasswordHasher in this package.
+	PasswordHasher interface {
+		Hash(password string) (string, error)
+
+		// NeedsRehash reports whether the hash was made with another
+		// algorithm or other parameters than Hash would use.
+		NeedsRehash(hash string) bool
+	}
+
+	// BcryptHasher hashes passwords with bcrypt. Only the first 72 bytes
+	// of a password are used.
+	BcryptHasher struct {
+		Cost int
+	}
+
+	// Argon2idHasher hashes passwords with argon2id, encoded in the PHC
+	// string format, e.g. "$argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>".
+	// Memory is in KiB.
+	Argon2idHasher struct {
+		Time       uint32
+		Memory     uint32
+		Threads    uint8
+		SaltLength int
+		KeyLength  uint32
+	}
+
+	argon2idHash struct {
+		Argon2idHasher
+		salt []byte
+		key  []byte
+	}
+)
+
+// VerifyPassword reports whether the password matches the bcrypt or
+// argon2id hash.
+func VerifyPassword(hash, password string) (bool, error) {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		h, err := parseArgon2idHash(hash)
+		if err != nil {
+			return false, err
+		}
+
+		key := argon2.IDKey([]byte(password), h.salt, h.Time, h.Memory, h.Threads, uint32(len(h.key)))
+
+		return subtle.ConstantTimeCompare(key, h.key) == 1, nil
+	}
+
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+		return false, ErrUnknownPasswordHash
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// Hash returns the bcrypt hash of the password.
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(hash), err
+}
+
+// NeedsRehash reports whether the hash is not a bcrypt hash of the Cost.
+func (h *BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.Cost
+}
+
+// Hash returns the argon2id hash of the password with a random salt.
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.Memory, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// NeedsRehash reports whether the hash is not an argon2id hash of the
+// hasher's parameters.
+func (h *Argon2idHasher) NeedsRehash(hash string) bool {
+	parsed, err := parseArgon2idHash(hash)
+	if err != nil {
+		return true
+	}
+
+	return parsed.Time != h.Time || parsed.Memory != h.Memory || parsed.Threads != h.Threads ||
+		len(parsed.salt) != h.SaltLength || uint32(len(parsed.key)) != h.KeyLength
+}
+
+func parseArgon2idHash(hash string) (*argon2idHash, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, ErrUnknownPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, ErrUnknownPasswordHash
+	}
+
+	h := new(argon2idHash)
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.Memory, &h.Time, &h.Threads); err != nil {
+		return nil, ErrUnknownPasswordHash
+	}
+
+	var err error
+
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, ErrUnknownPasswordHash
+	}
+
+	if h.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(h.key) == 0 {
+		return nil, ErrUnknownPasswordHash
+	}
+
+	h.SaltLength = len(h.salt)
+	h.KeyLength = uint32(len(h.key))
+
+	return h, nil
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2idHasher is cheap enough to hash in tests.
+var testArgon2idHasher = &Argon2idHasher{Time: 1, Memory: 64, Threads: 1, SaltLength: 16, KeyLength: 32}
+
+func TestVerifyPassword(t *testing.T) {
+	bcryptHash, err := (&BcryptHasher{Cost: bcrypt.MinCost}).Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	argonHash, err := testArgon2idHasher.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		ok       bool
+		err      error
+	}{
+		{"bcrypt", bcryptHash, "secret", true, nil},
+		{"bcrypt wrong password", bcryptHash, "wrong", false, nil},
+		{"argon2id", argonHash, "secret", true, nil},
+		{"argon2id wrong password", argonHash, "wrong", false, nil},
+		{"argon2id malformed", "$argon2id$v=19$m=64,t=1,p=1$!!!$!!!", "secret", false, ErrUnknownPasswordHash},
+		{"argon2id other version", "$argon2id$v=16$m=64,t=1,p=1$c2FsdA$a2V5", "secret", false, ErrUnknownPasswordHash},
+		{"plain text", "secret", "secret", false, ErrUnknownPasswordHash},
+		{"empty", "", "", false, ErrUnknownPasswordHash},
+	}
+
+	for _, tt := range tests {
+		ok, err := VerifyPassword(tt.hash, tt.password)
+		if ok != tt.ok || err != tt.err {
+			t.Errorf("%s: got %t, %v, want %t, %v", tt.name, ok, err, tt.ok, tt.err)
+		}
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	bcryptHash, err := (&BcryptHasher{Cost: bcrypt.MinCost}).Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	argonHash, err := testArgon2idHasher.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stronger := *testArgon2idHasher
+	stronger.Time++
+
+	longerKey := *testArgon2idHasher
+	longerKey.KeyLength *= 2
+
+	tests := []struct {
+		name   string
+		hasher PasswordHasher
+		hash   string
+		rehash bool
+	}{
+		{"same bcrypt cost", &BcryptHasher{Cost: bcrypt.MinCost}, bcryptHash, false},
+		{"higher bcrypt cost", &BcryptHasher{Cost: bcrypt.MinCost + 1}, bcryptHash, true},
+		{"bcrypt to argon2id", testArgon2idHasher, bcryptHash, true},
+		{"same argon2id parameters", testArgon2idHasher, argonHash, false},
+		{"more argon2id passes", &stronger, argonHash, true},
+		{"longer argon2id key", &longerKey, argonHash, true},
+		{"argon2id to bcrypt", &BcryptHasher{Cost: bcrypt.MinCost}, argonHash, true},
+		{"malformed", testArgon2idHasher, "$argon2id$", true},
+	}
+
+	for _, tt := range tests {
+		if rehash := tt.hasher.NeedsRehash(tt.hash); rehash != tt.rehash {
+			t.Errorf("%s: got %t, want %t", tt.name, rehash, tt.rehash)
+		}
+	}
+}
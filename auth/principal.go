@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+type (
+	// Principal is the authenticated caller of a request.
+	Principal struct {
+		ID       string
+		Username string
+		Roles    []string
+
+		// Claims holds every claim the principal was built from,
+		// including the ones above, as decoded from JSON.
+		Claims map[string]interface{}
+
+		// Token is the bearer token the principal authenticated with,
+		// if it authenticated with one. It is never marshalled.
+		Token Token `json:"-"`
+	}
+
+	principalKey struct{}
+)
+
+// NewPrincipal builds a Principal from the "id", "username" and "roles"
+// claims of a token, falling back to the OpenID Connect "sub" and
+// "preferred_username" claims. Numeric ids are formatted as decimal
+// strings and roles may be a list of strings or a single comma
+// separated string.
+func NewPrincipal(claims map[string]interface{}) *Principal {
+	p := &Principal{
+		Claims: claims,
+	}
+
+	p.ID = claimString(claims["id"])
+	if p.ID == "" {
+		p.ID = claimString(claims["sub"])
+	}
+
+	p.Username = claimString(claims["username"])
+	if p.Username == "" {
+		p.Username = claimString(claims["preferred_username"])
+	}
+
+	p.Roles = claimStrings(claims["roles"])
+
+	return p
+}
+
+// HasRole reports whether the principal has the given role.
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IntID returns the principal's id as an integer.
+func (p *Principal) IntID() (int64, error) {
+	return strconv.ParseInt(p.ID, 10, 64)
+}
+
+// Claim returns the claim with the given name.
+func (p *Principal) Claim(name string) (interface{}, bool) {
+	v, ok := p.Claims[name]
+	return v, ok
+}
+
+// WithPrincipal returns a copy of ctx that carries the principal.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal stored in ctx by WithPrincipal.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+func claimString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case json.Number:
+		return v.String()
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	default:
+		return ""
+	}
+}
+
+// claimStrings reads a claim holding a list of strings, or a single
+// comma separated string.
+func claimStrings(v interface{}) []string {
+	var list []string
+
+	switch v := v.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+	case []string:
+		list = append(list, v...)
+	case string:
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+
+	return list
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestNewPrincipal(t *testing.T) {
+	tests := []struct {
+		name     string
+		claims   map[string]interface{}
+		id       string
+		username string
+		roles    []string
+	}{
+		{
+			name:     "rm auth claims",
+			claims:   map[string]interface{}{"id": "7", "username": "bob", "roles": []interface{}{"admin", "user"}},
+			id:       "7",
+			username: "bob",
+			roles:    []string{"admin", "user"},
+		},
+		{
+			name:     "openid connect claims",
+			claims:   map[string]interface{}{"sub": "abc", "preferred_username": "alice"},
+			id:       "abc",
+			username: "alice",
+		},
+		{
+			name:     "id and username win over sub",
+			claims:   map[string]interface{}{"id": "7", "sub": "abc", "username": "bob", "preferred_username": "alice"},
+			id:       "7",
+			username: "bob",
+		},
+		{
+			name:   "float id",
+			claims: map[string]interface{}{"id": float64(42)},
+			id:     "42",
+		},
+		{
+			name:   "json number id",
+			claims: map[string]interface{}{"id": json.Number("12345678901234")},
+			id:     "12345678901234",
+		},
+		{
+			name:   "comma separated roles",
+			claims: map[string]interface{}{"roles": "admin, user,,"},
+			roles:  []string{"admin", "user"},
+		},
+		{
+			name:   "non-string roles are skipped",
+			claims: map[string]interface{}{"roles": []interface{}{"admin", 1.0}},
+			roles:  []string{"admin"},
+		},
+	}
+
+	for _, tt := range tests {
+		p := NewPrincipal(tt.claims)
+
+		if p.ID != tt.id {
+			t.Errorf("%s: got id %q, want %q", tt.name, p.ID, tt.id)
+		}
+
+		if p.Username != tt.username {
+			t.Errorf("%s: got username %q, want %q", tt.name, p.Username, tt.username)
+		}
+
+		if !reflect.DeepEqual(p.Roles, tt.roles) {
+			t.Errorf("%s: got roles %q, want %q", tt.name, p.Roles, tt.roles)
+		}
+	}
+}
+
+func TestPrincipalHelpers(t *testing.T) {
+	p := NewPrincipal(map[string]interface{}{"id": float64(42), "roles": "admin", "tenant": "acme"})
+
+	if !p.HasRole("admin") || p.HasRole("user") {
+		t.Errorf("HasRole: got roles %q", p.Roles)
+	}
+
+	if id, err := p.IntID(); err != nil || id != 42 {
+		t.Errorf("IntID: got %d, %v, want 42", id, err)
+	}
+
+	if v, ok := p.Claim("tenant"); !ok || v != "acme" {
+		t.Errorf("Claim: got %v, %v, want acme", v, ok)
+	}
+
+	if _, err := NewPrincipal(map[string]interface{}{"sub": "abc"}).IntID(); err == nil {
+		t.Error("IntID: want an error for a non-numeric id")
+	}
+}
+
+func TestPrincipalContext(t *testing.T) {
+	if _, ok := PrincipalFromContext(context.Background()); ok {
+		t.Error("got a principal from an empty context")
+	}
+
+	if _, ok := PrincipalFromContext(WithPrincipal(context.Background(), nil)); ok {
+		t.Error("got a nil principal from the context")
+	}
+
+	p := NewPrincipal(map[string]interface{}{"id": "7"})
+
+	got, ok := PrincipalFromContext(WithPrincipal(context.Background(), p))
+	if !ok || got != p {
+		t.Errorf("got %v, %v, want the stored principal", got, ok)
+	}
+}
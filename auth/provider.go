@@ -10,7 +10,7 @@ import (
 	"strings"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/golang-jwt/jwt"
 	"github.com/zjeremiah/stdlib/stats"
 	"github.com/zjeremiah/stdlib/xhttp"
 )
@@ -22,6 +22,10 @@ var (
 
 	// ErrNoJWTKeys is returned when the JWT keys were not able to be obtained.
 	ErrNoJWTKeys = errors.New("could not get JWT signing keys")
+
+	// ErrAuthUnavailable is returned when the auth server answers with a
+	// server error, e.g. while it is down behind a load balancer.
+	ErrAuthUnavailable = errors.New("auth server unavailable")
 )
 
 type (
@@ -95,7 +99,8 @@ func NewProviderWithStats(authHostname string, stats stats.Client) Provider {
 
 // NewFakeProvider returns an implementation of Provider.
 // This implementation always returns true and uses the
-// given signingKey to sign the JWT token.
+// given signingKey to sign the JWT token. The token's "id"
+// is the username and it has no roles.
 func NewFakeProvider(signingKey []byte) Provider {
 	return &fakeProvider{
 		signingKey: signingKey,
@@ -105,6 +110,8 @@ func NewFakeProvider(signingKey []byte) Provider {
 func (f *fakeProvider) Login(username, password string) (Token, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"username": username,
+		"roles":    []string{},
+		"id":       username,
 		"exp":      time.Now().Add(time.Hour * 24).Unix()})
 	signedToken, err := token.SignedString(f.signingKey)
 	if err != nil {
@@ -189,7 +196,9 @@ func (a *providerImpl) RequestSigningKeys(name, token string) (*SigningKeys, err
 		return nil, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, fmt.Errorf("%w: %s", ErrAuthUnavailable, resp.Status)
+	} else if resp.StatusCode != http.StatusOK {
 		return nil, ErrNoJWTKeys
 	}
 
@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for unknown, expired or revoked refresh tokens.
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+	// ErrRefreshTokenReused is returned when a refresh token that was
+	// already exchanged is presented again. The token's whole family is
+	// revoked, as either the legitimate client or an attacker holds a
+	// stolen copy.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+type (
+	// RefreshToken is the stored state of an issued refresh token.
+	// Every refresh token descends from a login; the tokens of one login
+	// share a Family, which is revoked as a whole when reuse is detected.
+	RefreshToken struct {
+		// Hash is the SHA-256 hex digest of the plain token.
+		Hash      string
+		Family    string
+		Claims    map[string]interface{}
+		ExpiresAt time.Time
+	}
+
+	// RefreshTokenStore keeps refresh tokens for an Issuer.
+	RefreshTokenStore interface {
+		// Save stores a newly issued refresh token. Tokens of revoked
+		// families are refused with ErrInvalidRefreshToken.
+		Save(t *RefreshToken) error
+
+		// Use marks the refresh token with the given hash as used and returns
+		// it. reused is true if it had been used before. Unknown and expired
+		// tokens and tokens of revoked families return ErrInvalidRefreshToken.
+		Use(hash string) (t *RefreshToken, reused bool, err error)
+
+		// RevokeFamily revokes every refresh token of the family.
+		RevokeFamily(family string) error
+	}
+
+	memoryRefreshStore struct {
+		mu       sync.Mutex
+		tokens   map[string]*memoryRefreshToken
+		families map[string]time.Time
+	}
+
+	memoryRefreshToken struct {
+		*RefreshToken
+		used bool
+	}
+)
+
+// NewMemoryRefreshStore returns a RefreshTokenStore that keeps refresh
+// tokens in memory. Tokens are lost on restart and not shared between replicas.
+func NewMemoryRefreshStore() RefreshTokenStore {
+	return &memoryRefreshStore{
+		tokens:   make(map[string]*memoryRefreshToken),
+		families: make(map[string]time.Time),
+	}
+}
+
+func (m *memoryRefreshStore) Save(t *RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	for hash, token := range m.tokens {
+		if token.ExpiresAt.Before(now) {
+			delete(m.tokens, hash)
+		}
+	}
+
+	for family, exp := range m.families {
+		if exp.Before(now) {
+			delete(m.families, family)
+		}
+	}
+
+	if _, revoked := m.families[t.Family]; revoked {
+		return ErrInvalidRefreshToken
+	}
+
+	m.tokens[t.Hash] = &memoryRefreshToken{RefreshToken: t}
+
+	return nil
+}
+
+func (m *memoryRefreshStore) Use(hash string) (*RefreshToken, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.tokens[hash]
+	if !ok || !token.ExpiresAt.After(time.Now()) {
+		return nil, false, ErrInvalidRefreshToken
+	}
+
+	if _, revoked := m.families[token.Family]; revoked {
+		return nil, false, ErrInvalidRefreshToken
+	}
+
+	reused := token.used
+	token.used = true
+
+	return token.RefreshToken, reused, nil
+}
+
+func (m *memoryRefreshStore) RevokeFamily(family string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var expiresAt time.Time
+
+	for hash, token := range m.tokens {
+		if token.Family == family {
+			if token.ExpiresAt.After(expiresAt) {
+				expiresAt = token.ExpiresAt
+			}
+
+			delete(m.tokens, hash)
+		}
+	}
+
+	m.families[family] = expiresAt
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// RevocationStore records revoked tokens. Tokens can be revoked one
+	// at a time by their "jti" claim, or all tokens of a user issued
+	// before a point in time can be revoked at once, e.g. to force a logout.
+	RevocationStore interface {
+		// IsRevoked reports whether the token with the given id, user id and
+		// issue time has been revoked. A zero issuedAt is treated as older
+		// than any user revocation.
+		IsRevoked(jti, userID string, issuedAt time.Time) (bool, error)
+
+		// RevokeToken revokes the token with the given id. The revocation
+		// may be forgotten after expiresAt, once the token is expired anyway.
+		RevokeToken(jti string, expiresAt time.Time) error
+
+		// RevokeUser revokes every token of the user issued before the given time.
+		RevokeUser(userID string, before time.Time) error
+	}
+
+	memoryRevocationStore struct {
+		mu     sync.RWMutex
+		tokens map[string]time.Time
+		users  map[string]time.Time
+	}
+)
+
+// NewMemoryRevocationStore returns a RevocationStore that keeps revocations
+// in memory. Revocations are lost on restart and not shared between replicas.
+func NewMemoryRevocationStore() RevocationStore {
+	return &memoryRevocationStore{
+		tokens: make(map[string]time.Time),
+		users:  make(map[string]time.Time),
+	}
+}
+
+func (m *memoryRevocationStore) IsRevoked(jti, userID string, issuedAt time.Time) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if jti != "" {
+		if _, ok := m.tokens[jti]; ok {
+			return true, nil
+		}
+	}
+
+	if userID != "" {
+		if before, ok := m.users[userID]; ok && issuedAt.Before(before) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (m *memoryRevocationStore) RevokeToken(jti string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	for id, exp := range m.tokens {
+		if exp.Before(now) {
+			delete(m.tokens, id)
+		}
+	}
+
+	m.tokens[jti] = expiresAt
+
+	return nil
+}
+
+func (m *memoryRevocationStore) RevokeUser(userID string, before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if current, ok := m.users[userID]; !ok || before.After(current) {
+		m.users[userID] = before
+	}
+
+	return nil
+}
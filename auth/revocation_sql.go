@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/zjeremiah/stdlib/data"
+)
+
+// RevocationSchema creates the tables used by the SQL RevocationStore.
+// Times are stored as unix seconds so the schema works across databases.
+// Run the statements one at a time if the driver does not support
+// multiple statements per Exec.
+const RevocationSchema = `
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+	jti        VARCHAR(255) PRIMARY KEY,
+	expires_at BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS revoked_users (
+	user_id        VARCHAR(255) PRIMARY KEY,
+	revoked_before BIGINT NOT NULL
+);`
+
+// DefaultRevocationCacheTTL is how long the SQL RevocationStore trusts a
+// lookup before asking the database again.
+const DefaultRevocationCacheTTL = time.Second * 30
+
+// maxRevocationCacheEntries is the cache size after which expired
+// entries are swept.
+const maxRevocationCacheEntries = 10000
+
+type (
+	sqlRevocationStore struct {
+		db  data.SqlxWrapper
+		ttl time.Duration
+
+		mu     sync.Mutex
+		tokens map[string]revocationCacheEntry
+		users  map[string]revocationCacheEntry
+	}
+
+	revocationCacheEntry struct {
+		revoked bool
+		before  int64
+		expires time.Time
+	}
+)
+
+// NewSQLRevocationStore returns a RevocationStore backed by the tables in
+// RevocationSchema. Lookups are cached locally for cacheTTL, so the hot
+// path does not hit the database on every request; revocations made on
+// other replicas take up to cacheTTL to be seen. Revocations made through
+// this store are seen immediately.
+func NewSQLRevocationStore(db data.SqlxWrapper, cacheTTL time.Duration) RevocationStore {
+	return &sqlRevocationStore{
+		db:     db,
+		ttl:    cacheTTL,
+		tokens: make(map[string]revocationCacheEntry),
+		users:  make(map[string]revocationCacheEntry),
+	}
+}
+
+func (s *sqlRevocationStore) IsRevoked(jti, userID string, issuedAt time.Time) (bool, error) {
+	if jti != "" {
+		revoked, err := s.tokenRevoked(jti)
+		if err != nil || revoked {
+			return revoked, err
+		}
+	}
+
+	if userID != "" {
+		before, err := s.userRevokedBefore(userID)
+		if err != nil {
+			return false, err
+		}
+
+		if before != 0 && issuedAt.Unix() < before {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (s *sqlRevocationStore) RevokeToken(jti string, expiresAt time.Time) error {
+	if _, err := s.db.Exec(s.db.Rebind(`DELETE FROM revoked_tokens WHERE expires_at < ?`), time.Now().Unix()); err != nil {
+		return err
+	}
+
+	err := upsert(s.db,
+		`UPDATE revoked_tokens SET expires_at = ? WHERE jti = ?`, []interface{}{expiresAt.Unix(), jti},
+		`INSERT INTO revoked_tokens (jti, expires_at) VALUES (?, ?)`, jti, expiresAt.Unix())
+	if err != nil {
+		return err
+	}
+
+	s.cache(s.tokens, jti, revocationCacheEntry{revoked: true})
+
+	return nil
+}
+
+func (s *sqlRevocationStore) RevokeUser(userID string, before time.Time) error {
+	err := upsert(s.db,
+		`UPDATE revoked_users SET revoked_before = CASE WHEN revoked_before < ? THEN ? ELSE revoked_before END WHERE user_id = ?`,
+		[]interface{}{before.Unix(), before.Unix(), userID},
+		`INSERT INTO revoked_users (user_id, revoked_before) VALUES (?, ?)`, userID, before.Unix())
+	if err != nil {
+		return err
+	}
+
+	var revokedBefore int64
+	if err := s.db.Get(&revokedBefore, s.db.Rebind(`SELECT revoked_before FROM revoked_users WHERE user_id = ?`), userID); err != nil {
+		return err
+	}
+
+	s.cache(s.users, userID, revocationCacheEntry{before: revokedBefore})
+
+	return nil
+}
+
+func (s *sqlRevocationStore) tokenRevoked(jti string) (bool, error) {
+	if entry, ok := s.cached(s.tokens, jti); ok {
+		return entry.revoked, nil
+	}
+
+	var count int
+	if err := s.db.Get(&count, s.db.Rebind(`SELECT COUNT(*) FROM revoked_tokens WHERE jti = ?`), jti); err != nil {
+		return false, err
+	}
+
+	s.cache(s.tokens, jti, revocationCacheEntry{revoked: count > 0})
+
+	return count > 0, nil
+}
+
+func (s *sqlRevocationStore) userRevokedBefore(userID string) (int64, error) {
+	if entry, ok := s.cached(s.users, userID); ok {
+		return entry.before, nil
+	}
+
+	var before int64
+
+	err := s.db.Get(&before, s.db.Rebind(`SELECT revoked_before FROM revoked_users WHERE user_id = ?`), userID)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	s.cache(s.users, userID, revocationCacheEntry{before: before})
+
+	return before, nil
+}
+
+func (s *sqlRevocationStore) cached(m map[string]revocationCacheEntry, key string) (revocationCacheEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := m[key]
+	if !ok || time.Now().After(entry.expires) {
+		return revocationCacheEntry{}, false
+	}
+
+	return entry, true
+}
+
+func (s *sqlRevocationStore) cache(m map[string]revocationCacheEntry, key string, entry revocationCacheEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	if len(m) >= maxRevocationCacheEntries {
+		for k, e := range m {
+			if now.After(e.expires) {
+				delete(m, k)
+			}
+		}
+	}
+
+	entry.expires = now.Add(s.ttl)
+	m[key] = entry
+}
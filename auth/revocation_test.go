@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSQLRevocationStoreRevokeRaces(t *testing.T) {
+	db := newTestDB(t, RevocationSchema)
+
+	now := time.Now().Truncate(time.Second)
+	expiresAt := now.Add(time.Hour)
+
+	racing := &racingDB{SqlxWrapper: db}
+	racing.race = func() {
+		other := NewSQLRevocationStore(db, 0)
+
+		if err := other.RevokeToken("jti-1", expiresAt); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := other.RevokeUser("bob", now.Add(time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store := NewSQLRevocationStore(racing, time.Minute)
+
+	if err := store.RevokeToken("jti-1", expiresAt); err != nil {
+		t.Fatalf("concurrent token revocation failed: %v", err)
+	}
+
+	// The concurrent revocation is later, so it is kept.
+	if err := store.RevokeUser("bob", now); err != nil {
+		t.Fatalf("concurrent user revocation failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		jti      string
+		userID   string
+		issuedAt time.Time
+		revoked  bool
+	}{
+		{"revoked token", "jti-1", "alice", now, true},
+		{"other token", "jti-2", "alice", now, false},
+		{"issued before the later revocation", "jti-2", "bob", now.Add(30 * time.Second), true},
+		{"issued after it", "jti-2", "bob", now.Add(2 * time.Minute), false},
+	}
+
+	for _, tt := range tests {
+		revoked, err := store.IsRevoked(tt.jti, tt.userID, tt.issuedAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if revoked != tt.revoked {
+			t.Errorf("%s: got revoked %t, want %t", tt.name, revoked, tt.revoked)
+		}
+	}
+}
+
+func TestRevocationStores(t *testing.T) {
+	stores := map[string]RevocationStore{
+		"memory": NewMemoryRevocationStore(),
+		"sql":    NewSQLRevocationStore(newTestDB(t, RevocationSchema), 0),
+	}
+
+	now := time.Now().Truncate(time.Second)
+
+	for name, store := range stores {
+		if err := store.RevokeToken("jti-1", now.Add(time.Hour)); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if err := store.RevokeUser("bob", now); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		// An older revocation must not move the cutoff back.
+		if err := store.RevokeUser("bob", now.Add(-time.Hour)); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		tests := []struct {
+			jti, userID string
+			issuedAt    time.Time
+			revoked     bool
+		}{
+			{"jti-1", "alice", now, true},
+			{"jti-2", "alice", now.Add(-time.Hour), false},
+			{"jti-2", "bob", now.Add(-time.Minute), true},
+			{"", "bob", time.Time{}, true},
+			{"jti-2", "bob", now.Add(time.Minute), false},
+		}
+
+		for _, tt := range tests {
+			revoked, err := store.IsRevoked(tt.jti, tt.userID, tt.issuedAt)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+
+			if revoked != tt.revoked {
+				t.Errorf("%s: IsRevoked(%q, %q, %v): got %v, want %v", name, tt.jti, tt.userID, tt.issuedAt, revoked, tt.revoked)
+			}
+		}
+	}
+}
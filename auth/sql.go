@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"github.com/zjeremiah/stdlib/data"
+)
+
+// upsert runs update and, if it matched no row, insert. When a concurrent
+// upsert inserts the row first, the insert fails on the key; update is
+// then tried once more instead of returning that error. It must not run
+// in a transaction, as some databases abort it on the failed insert.
+// MySQL only counts changed rows as affected unless the DSN sets
+// clientFoundRows=true, which update needs if it can leave a row as is.
+func upsert(db data.DataContext, update string, updateArgs []interface{}, insert string, insertArgs ...interface{}) error {
+	matched, err := execMatched(db, update, updateArgs...)
+	if err != nil || matched {
+		return err
+	}
+
+	_, insertErr := db.Exec(db.Rebind(insert), insertArgs...)
+	if insertErr == nil {
+		return nil
+	}
+
+	if matched, err := execMatched(db, update, updateArgs...); err != nil || !matched {
+		return insertErr
+	}
+
+	return nil
+}
+
+// execMatched runs the query and reports whether it affected a row.
+func execMatched(db data.DataContext, query string, args ...interface{}) (bool, error) {
+	result, err := db.Exec(db.Rebind(query), args...)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+
+	return n > 0, err
+}
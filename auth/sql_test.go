@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/zjeremiah/stdlib/data"
+)
+
+// newTestDB returns a database in a temporary file with the schemas created.
+func newTestDB(t *testing.T, schemas ...string) data.SqlxWrapper {
+	t.Helper()
+
+	db, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "test.db")+"?_busy_timeout=5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	for _, schema := range schemas {
+		if _, err := db.Exec(schema); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return data.NewSqlxWrapper(db)
+}
+
+// racingDB inserts a row through race right before the first INSERT it
+// runs, like a concurrent writer that got there first.
+type racingDB struct {
+	data.SqlxWrapper
+
+	race func()
+	once sync.Once
+}
+
+func (r *racingDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	if strings.HasPrefix(query, "INSERT") {
+		r.once.Do(r.race)
+	}
+
+	return r.SqlxWrapper.Exec(query, args...)
+}
+
+func (r *racingDB) NamedExec(query string, arg interface{}) (sql.Result, error) {
+	if strings.HasPrefix(query, "INSERT") {
+		r.once.Do(r.race)
+	}
+
+	return r.SqlxWrapper.NamedExec(query, arg)
+}
+
+func TestUpsertLosesInsertRace(t *testing.T) {
+	db := newTestDB(t, `CREATE TABLE counters (name VARCHAR(255) PRIMARY KEY, n INTEGER NOT NULL)`)
+
+	racing := &racingDB{SqlxWrapper: db, race: func() {
+		db.MustExec(`INSERT INTO counters (name, n) VALUES ('a', 1)`)
+	}}
+
+	err := upsert(racing,
+		`UPDATE counters SET n = n + 1 WHERE name = ?`, []interface{}{"a"},
+		`INSERT INTO counters (name, n) VALUES (?, 1)`, "a")
+	if err != nil {
+		t.Fatalf("upsert returned the duplicate key error: %v", err)
+	}
+
+	var n int
+	if err := db.Get(&n, `SELECT n FROM counters WHERE name = 'a'`); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 2 {
+		t.Errorf("got %d, want 2", n)
+	}
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/zjeremiah/stdlib/stats/prometheus"
+)
+
+// PrometheusCollectors is a prepopulated list of prometheus collectors.
+// This must be used when using the stats collectors in this package
+// with prometheus.
+func PrometheusCollectors(app, team, env string) prometheus.Collectors {
+	return prometheus.Collectors{
+		"auth_audit_events": prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "auth_audit_events",
+				Help: "The number of audit events by type and reason",
+				ConstLabels: prom.Labels{
+					"app":  app,
+					"team": team,
+					"env":  env,
+				},
+			},
+			[]string{"type", "reason"},
+		),
+		"auth_audit_sink_errors": prom.NewCounter(
+			prom.CounterOpts{
+				Name: "auth_audit_sink_errors",
+				Help: "The number of audit events that could not be stored",
+				ConstLabels: prom.Labels{
+					"app":  app,
+					"team": team,
+					"env":  env,
+				},
+			},
+		),
+		"auth_api_key_last_used_errors": prom.NewCounter(
+			prom.CounterOpts{
+				Name: "auth_api_key_last_used_errors",
+				Help: "The number of api key uses that could not be recorded",
+				ConstLabels: prom.Labels{
+					"app":  app,
+					"team": team,
+					"env":  env,
+				},
+			},
+		),
+	}
+}
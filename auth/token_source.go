@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/zjeremiah/stdlib/xhttp"
+)
+
+// TokenSource returns an xhttp.TokenSource that logs in to the provider
+// with the given credentials. The expiry is read from the token's "exp"
+// claim without verifying it; the token is the client's own credential.
+func TokenSource(provider Provider, username, password string) xhttp.TokenSource {
+	return func() (string, time.Time, error) {
+		token, err := provider.Login(username, password)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+
+		return token.String(), TokenExpiry(token), nil
+	}
+}
+
+// NewBearerClient returns an xhttp.BearerClient that authenticates its
+// requests with tokens the provider issues for the given credentials.
+func NewBearerClient(provider Provider, username, password string, client xhttp.Client) *xhttp.BearerClient {
+	return xhttp.NewBearerClient(client, TokenSource(provider, username, password))
+}
+
+// TokenExpiry returns the time in the token's "exp" claim without
+// verifying the token. It returns the zero time if there is none.
+func TokenExpiry(token Token) time.Time {
+	claims := jwt.MapClaims{}
+
+	if _, _, err := new(jwt.Parser).ParseUnverified(token.String(), claims); err != nil {
+		return time.Time{}
+	}
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return time.Time{}
+	}
+
+	return time.Unix(int64(exp), 0)
+}
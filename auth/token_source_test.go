@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingProvider struct {
+	Provider
+
+	logins int64
+}
+
+func (p *countingProvider) Login(username, password string) (Token, error) {
+	atomic.AddInt64(&p.logins, 1)
+	time.Sleep(10 * time.Millisecond)
+
+	return p.Provider.Login(username, password)
+}
+
+func TestNewBearerClientLogsInOnce(t *testing.T) {
+	var reject int64
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.CompareAndSwapInt64(&reject, 1, 0) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	provider := &countingProvider{Provider: NewFakeProvider([]byte("key"))}
+	client := NewBearerClient(provider, "bob", "password", http.DefaultClient)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			resp.Body.Close()
+		}()
+	}
+
+	wg.Wait()
+
+	if n := atomic.LoadInt64(&provider.logins); n != 1 {
+		t.Errorf("got %d logins for concurrent requests, want 1", n)
+	}
+
+	// A rejected token is replaced once and the request retried.
+	atomic.StoreInt64(&reject, 1)
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp.Body.Close()
+
+	if n := atomic.LoadInt64(&provider.logins); resp.StatusCode != http.StatusOK || n != 2 {
+		t.Errorf("got status %d after %d logins, want 200 after 2", resp.StatusCode, n)
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	token, err := NewFakeProvider([]byte("key")).Login("bob", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := TokenExpiry(token); time.Until(exp) < 23*time.Hour {
+		t.Errorf("got expiry %s, want the token's exp a day from now", exp)
+	}
+
+	if exp := TokenExpiry(Token("not a token")); !exp.IsZero() {
+		t.Errorf("got expiry %s for a malformed token, want none", exp)
+	}
+}
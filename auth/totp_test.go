@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B, SHA-1, truncated to TOTPDigits.
+func TestTOTPCodeRFC6238(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := TOTPCode(secret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if code != tt.code {
+			t.Errorf("code at %d: got %s, want %s", tt.unix, code, tt.code)
+		}
+
+		if _, ok := ValidateTOTP(secret, tt.code, time.Unix(tt.unix, 0).Add(TOTPPeriod)); !ok {
+			t.Errorf("code at %d rejected one period later", tt.unix)
+		}
+
+		if _, ok := ValidateTOTP(secret, tt.code, time.Unix(tt.unix, 0).Add(3*TOTPPeriod)); ok {
+			t.Errorf("code at %d accepted three periods later", tt.unix)
+		}
+	}
+}
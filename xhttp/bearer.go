@@ -0,0 +1,175 @@
+package xhttp
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTokenExpirySkew is how long before its expiry a cached token is replaced.
+const DefaultTokenExpirySkew = 30 * time.Second
+
+type (
+	// TokenSource obtains a new bearer token and the time it expires.
+	// A zero expiry means the token is used until the server rejects it.
+	TokenSource func() (token string, expiresAt time.Time, err error)
+
+	// BearerClient is a wrapper around Client that sets a bearer token on
+	// every request. The token is cached until shortly before it expires.
+	// When a request comes back 401 the token is refreshed once and the
+	// request retried. Concurrent callers share a single refresh.
+	BearerClient struct {
+		httpClient Client
+		source     TokenSource
+
+		// ExpirySkew is how long before its expiry a token is refreshed.
+		ExpirySkew time.Duration
+
+		mu      sync.Mutex
+		token   string
+		expires time.Time
+		call    *tokenCall
+	}
+
+	tokenCall struct {
+		done  chan struct{}
+		token string
+		err   error
+	}
+)
+
+// NewBearerClient returns a BearerClient that sends requests through
+// httpClient with tokens from source.
+func NewBearerClient(httpClient Client, source TokenSource) *BearerClient {
+	return &BearerClient{
+		httpClient: httpClient,
+		source:     source,
+		ExpirySkew: DefaultTokenExpirySkew,
+	}
+}
+
+// Do sends the request with a bearer token. The request is not modified.
+// Requests with a body are only retried after a 401 if the body can be
+// replayed, i.e. req.GetBody is set as http.NewRequest does for in-memory bodies.
+func (b *BearerClient) Do(req *http.Request) (*http.Response, error) {
+	token, err := b.currentToken("")
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := b.httpClient.Do(withBearer(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+
+	retry := req.Clone(req.Context())
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+
+		retry.Body = body
+	}
+
+	token, err = b.currentToken(token)
+	if err != nil {
+		return resp, nil
+	}
+
+	resp.Body.Close()
+
+	return b.httpClient.Do(withBearer(retry, token))
+}
+
+// Get sends a GET request with a bearer token.
+func (b *BearerClient) Get(u string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.Do(req)
+}
+
+// Head sends a HEAD request with a bearer token.
+func (b *BearerClient) Head(u string) (*http.Response, error) {
+	req, err := http.NewRequest("HEAD", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.Do(req)
+}
+
+// Post sends a POST request with a bearer token.
+func (b *BearerClient) Post(u, bodyType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest("POST", u, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", bodyType)
+
+	return b.Do(req)
+}
+
+// PostForm sends a form POST request with a bearer token.
+func (b *BearerClient) PostForm(u string, data url.Values) (*http.Response, error) {
+	return b.Post(u, "application/x-www-form-urlencoded", strings.NewReader(data.Encode()))
+}
+
+// currentToken returns the cached token, or obtains a new one if it is
+// about to expire or is the rejected token.
+func (b *BearerClient) currentToken(rejected string) (string, error) {
+	b.mu.Lock()
+
+	fresh := b.expires.IsZero() || time.Now().Before(b.expires.Add(-b.ExpirySkew))
+	if b.token != "" && b.token != rejected && (fresh || rejected != "") {
+		token := b.token
+		b.mu.Unlock()
+
+		return token, nil
+	}
+
+	if call := b.call; call != nil {
+		b.mu.Unlock()
+		<-call.done
+
+		return call.token, call.err
+	}
+
+	call := &tokenCall{done: make(chan struct{})}
+	b.call = call
+	b.mu.Unlock()
+
+	token, expires, err := b.source()
+
+	b.mu.Lock()
+	if err == nil {
+		b.token = token
+		b.expires = expires
+	}
+	b.call = nil
+	b.mu.Unlock()
+
+	call.token, call.err = token, err
+	close(call.done)
+
+	return token, err
+}
+
+func withBearer(req *http.Request, token string) *http.Request {
+	r := req.Clone(req.Context())
+	r.Header.Set("Authorization", "Bearer "+token)
+
+	return r
+}
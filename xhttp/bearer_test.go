@@ -0,0 +1,111 @@
+package xhttp
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingSource returns the tokens "t1", "t2", ... and counts its calls.
+type countingSource struct {
+	calls int64
+	delay time.Duration
+}
+
+func (s *countingSource) token() (string, time.Time, error) {
+	n := atomic.AddInt64(&s.calls, 1)
+	time.Sleep(s.delay)
+
+	return "t" + strconv.FormatInt(n, 10), time.Time{}, nil
+}
+
+func TestBearerClientSharesTokenFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t1" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	source := &countingSource{delay: 20 * time.Millisecond}
+	client := NewBearerClient(http.DefaultClient, source.token)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("got status %d, want 200", resp.StatusCode)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if n := atomic.LoadInt64(&source.calls); n != 1 {
+		t.Errorf("got %d token fetches, want 1", n)
+	}
+}
+
+func TestBearerClientRetriesOnce(t *testing.T) {
+	tests := []struct {
+		name     string
+		accepted string
+		code     int
+		requests int64
+		fetches  int64
+	}{
+		{"refreshed token accepted", "Bearer t2", http.StatusOK, 2, 2},
+		{"refreshed token rejected", "", http.StatusUnauthorized, 2, 2},
+	}
+
+	for _, tt := range tests {
+		var requests int64
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(&requests, 1)
+
+			if body, _ := ioutil.ReadAll(r.Body); string(body) != "payload" {
+				t.Errorf("%s: got body %q, want %q", tt.name, body, "payload")
+			}
+
+			if r.Header.Get("Authorization") != tt.accepted {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}))
+
+		source := new(countingSource)
+		client := NewBearerClient(http.DefaultClient, source.token)
+
+		resp, err := client.Post(server.URL, "text/plain", strings.NewReader("payload"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp.Body.Close()
+		server.Close()
+
+		if resp.StatusCode != tt.code || requests != tt.requests || source.calls != tt.fetches {
+			t.Errorf("%s: got status %d after %d requests and %d token fetches, want %d after %d and %d",
+				tt.name, resp.StatusCode, requests, source.calls, tt.code, tt.requests, tt.fetches)
+		}
+	}
+}
@@ -1,11 +1,49 @@
 package xhttp
 
-import "fmt"
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// Values of Config.ClientAuth.
+const (
+	ClientAuthNone             = "none"
+	ClientAuthRequest          = "request"
+	ClientAuthRequire          = "require"
+	ClientAuthVerifyIfGiven    = "verify_if_given"
+	ClientAuthRequireAndVerify = "require_and_verify"
+)
+
+var (
+	// ErrUnknownClientAuth is returned for an unknown Config.ClientAuth.
+	ErrUnknownClientAuth = errors.New("unknown client auth type")
+
+	// ErrNoClientCAs is returned when a ClientCAFile holds no certificates.
+	ErrNoClientCAs = errors.New("no client ca certificates found")
+)
 
 // Config contains configuration to start an http server.
 type Config struct {
 	Address string `default:"0.0.0.0"`
 	Port    int    `default:"8080"`
+
+	// CertFile and KeyFile are the PEM encoded certificate and key the
+	// server serves TLS with.
+	CertFile string
+	KeyFile  string
+
+	// ClientCAFile is a PEM file of the CAs client certificates are
+	// verified against.
+	ClientCAFile string
+
+	// ClientAuth is whether client certificates are requested and
+	// verified, one of the ClientAuth constants. It defaults to
+	// ClientAuthRequireAndVerify if a ClientCAFile is set, and to
+	// ClientAuthNone otherwise.
+	ClientAuth string
 }
 
 // ListenAddress returns a formatted string to be passed into
@@ -14,3 +52,74 @@ type Config struct {
 func (h *Config) ListenAddress() string {
 	return fmt.Sprintf("%s:%d", h.Address, h.Port)
 }
+
+// TLSConfig returns the server's tls.Config, or nil if no CertFile is
+// set. The certificate is loaded already, so pass empty file names to
+// http.Server.ListenAndServeTLS.
+func (h *Config) TLSConfig() (*tls.Config, error) {
+	if h.CertFile == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(h.CertFile, h.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	clientAuth, err := h.clientAuthType()
+	if err != nil {
+		return nil, err
+	}
+
+	conf := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   clientAuth,
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if h.ClientCAFile != "" {
+		if conf.ClientCAs, err = h.ClientCAs(); err != nil {
+			return nil, err
+		}
+	}
+
+	return conf, nil
+}
+
+// ClientCAs returns the pool of CAs in the ClientCAFile.
+func (h *Config) ClientCAs() (*x509.CertPool, error) {
+	b, err := ioutil.ReadFile(h.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, ErrNoClientCAs
+	}
+
+	return pool, nil
+}
+
+func (h *Config) clientAuthType() (tls.ClientAuthType, error) {
+	switch h.ClientAuth {
+	case "":
+		if h.ClientCAFile != "" {
+			return tls.RequireAndVerifyClientCert, nil
+		}
+
+		return tls.NoClientCert, nil
+	case ClientAuthNone:
+		return tls.NoClientCert, nil
+	case ClientAuthRequest:
+		return tls.RequestClientCert, nil
+	case ClientAuthRequire:
+		return tls.RequireAnyClientCert, nil
+	case ClientAuthVerifyIfGiven:
+		return tls.VerifyClientCertIfGiven, nil
+	case ClientAuthRequireAndVerify:
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return 0, fmt.Errorf("%w: %s", ErrUnknownClientAuth, h.ClientAuth)
+	}
+}
@@ -0,0 +1,170 @@
+package xhttp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers of signed requests. HeaderSignature holds a comma separated
+// "<key id>=<hex signature>" pair for every key the request was signed with.
+const (
+	HeaderSignature          = "X-Signature"
+	HeaderSignatureTimestamp = "X-Signature-Timestamp"
+	HeaderSignatureNonce     = "X-Signature-Nonce"
+)
+
+// ErrNoSigningKeys is returned when signing a request without keys.
+var ErrNoSigningKeys = errors.New("no request signing keys")
+
+type (
+	// SigningKey is a shared HMAC secret and the ID it is known by.
+	SigningKey struct {
+		ID     string
+		Secret []byte
+	}
+
+	// SigningClient is a wrapper around Client that signs every request
+	// with HMAC-SHA256 over its method, path and query, timestamp, nonce
+	// and body. Each request is signed with all keys, so receivers can
+	// verify it while keys are rotated.
+	SigningClient struct {
+		httpClient Client
+
+		mu   sync.RWMutex
+		keys []SigningKey
+	}
+)
+
+// NewSigningClient returns a SigningClient that sends requests through
+// httpClient signed with the keys.
+func NewSigningClient(httpClient Client, keys ...SigningKey) *SigningClient {
+	return &SigningClient{
+		httpClient: httpClient,
+		keys:       keys,
+	}
+}
+
+// SetKeys replaces the keys requests are signed with, e.g. to rotate them.
+func (s *SigningClient) SetKeys(keys ...SigningKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys = keys
+}
+
+// Do sends the signed request. The request's headers are not modified.
+func (s *SigningClient) Do(req *http.Request) (*http.Response, error) {
+	s.mu.RLock()
+	keys := s.keys
+	s.mu.RUnlock()
+
+	signed := req.Clone(req.Context())
+
+	if err := SignRequest(signed, time.Now(), keys...); err != nil {
+		return nil, err
+	}
+
+	return s.httpClient.Do(signed)
+}
+
+// Get sends a signed GET request.
+func (s *SigningClient) Get(u string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Do(req)
+}
+
+// Head sends a signed HEAD request.
+func (s *SigningClient) Head(u string) (*http.Response, error) {
+	req, err := http.NewRequest("HEAD", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Do(req)
+}
+
+// Post sends a signed POST request.
+func (s *SigningClient) Post(u, bodyType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest("POST", u, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", bodyType)
+
+	return s.Do(req)
+}
+
+// PostForm sends a signed form POST request.
+func (s *SigningClient) PostForm(u string, data url.Values) (*http.Response, error) {
+	return s.Post(u, "application/x-www-form-urlencoded", strings.NewReader(data.Encode()))
+}
+
+// SignRequest sets the signature headers on the request for the keys. The
+// body is read and replaced, so it can still be sent.
+func SignRequest(req *http.Request, now time.Time, keys ...SigningKey) error {
+	if len(keys) == 0 {
+		return ErrNoSigningKeys
+	}
+
+	var body []byte
+
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return err
+		}
+
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	nonce := hex.EncodeToString(b)
+
+	signatures := make([]string, len(keys))
+	for i, key := range keys {
+		signatures[i] = key.ID + "=" + RequestSignature(key.Secret, req.Method, req.URL.RequestURI(), timestamp, nonce, body)
+	}
+
+	req.Header.Set(HeaderSignatureTimestamp, timestamp)
+	req.Header.Set(HeaderSignatureNonce, nonce)
+	req.Header.Set(HeaderSignature, strings.Join(signatures, ","))
+
+	return nil
+}
+
+// RequestSignature returns the hex encoded HMAC-SHA256 of a request, where
+// uri is its path and query as in http.Request.RequestURI.
+func RequestSignature(secret []byte, method, uri, timestamp, nonce string, body []byte) string {
+	bodySum := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strings.Join([]string{method, uri, timestamp, nonce, hex.EncodeToString(bodySum[:])}, "\n")))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}